@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/arthurk/feed/cleanup"
+)
+
+// loadCache reads the cache from filename. A missing or corrupt file
+// results in an empty cache, so all feeds are checked again.
+func loadCache(filename string) *cleanup.Cache {
+	fc := cleanup.NewCache()
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			warnf("reading cache: %s", err)
+		}
+		return fc
+	}
+	if err := json.Unmarshal(data, fc); err != nil {
+		warnf("ignoring corrupt cache %s: %s", filename, err)
+	}
+	return fc
+}
+
+// saveCache writes fc to filename
+func saveCache(fc *cleanup.Cache, filename string) error {
+	data, err := json.MarshalIndent(fc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, append(data, '\n'))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/arthurk/feed/cleanup"
+)
+
+// Failure categories, in the order they are shown in the summary
+const (
+	failDNS      = "dns"
+	failRefused  = "connection refused"
+	failTimeout  = "timeout"
+	failTLS      = "tls"
+	failClient   = "4xx"
+	failServer   = "5xx"
+	failParse    = "parse error"
+	failNotAFeed = "not a feed"
+	failEmpty    = "empty feed"
+	failParked   = "parked domain"
+	failTooLarge = "too large"
+	failInvalid  = "invalid URL"
+	failRedirect = "too many redirects"
+	failOther    = "other"
+)
+
+var failCategories = []string{
+	failDNS, failRefused, failTimeout, failTLS, failClient, failServer,
+	failParse, failNotAFeed, failEmpty, failParked, failTooLarge, failInvalid,
+	failRedirect, failOther,
+}
+
+// classifyError returns the failure category of err
+func classifyError(err error) string {
+	var serr *cleanup.StatusError
+	if errors.As(err, &serr) {
+		if serr.Status >= 500 {
+			return failServer
+		}
+		return failClient
+	}
+	var dnsErr *net.DNSError
+	var terr *cleanup.TimeoutError
+	var tlsErr *cleanup.TLSError
+	var perr *cleanup.ParseError
+	var nerr *cleanup.NotFeedError
+	var eerr *cleanup.EmptyFeedError
+	var parked *cleanup.ParkedError
+	var large *cleanup.TooLargeError
+	var invalid *cleanup.InvalidURLError
+	var redirect *cleanup.RedirectError
+	switch {
+	case errors.As(err, &terr):
+		return failTimeout
+	case errors.As(err, &dnsErr):
+		return failDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return failRefused
+	case errors.As(err, &tlsErr):
+		return failTLS
+	case errors.As(err, &perr):
+		return failParse
+	case errors.As(err, &nerr):
+		return failNotAFeed
+	case errors.As(err, &eerr):
+		return failEmpty
+	case errors.As(err, &parked):
+		return failParked
+	case errors.As(err, &large):
+		return failTooLarge
+	case errors.As(err, &invalid):
+		return failInvalid
+	case errors.As(err, &redirect):
+		return failRedirect
+	}
+	return failOther
+}
+
+// countFailures returns the number of failed results per category
+func countFailures(failed []cleanup.FeedResult) map[string]int {
+	counts := map[string]int{}
+	for _, r := range failed {
+		counts[classifyError(r.Err)]++
+	}
+	return counts
+}
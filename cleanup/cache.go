@@ -0,0 +1,61 @@
+package cleanup
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// cacheEntry holds the validators of a feed response, used to make
+// conditional requests on the next run
+type cacheEntry struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// Cache maps feed urls to the ETag and Last-Modified headers of their
+// last successful response. Feeds that haven't changed since then are
+// not downloaded again. It is safe for concurrent use and can be stored
+// as JSON.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// NewCache returns an empty cache
+func NewCache() *Cache {
+	return &Cache{entries: map[string]cacheEntry{}}
+}
+
+func (fc *Cache) get(url string) (cacheEntry, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	e, ok := fc.entries[url]
+	return e, ok
+}
+
+func (fc *Cache) set(url string, e cacheEntry) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if e.ETag == "" && e.LastModified == "" {
+		delete(fc.entries, url)
+		return
+	}
+	fc.entries[url] = e
+}
+
+func (fc *Cache) MarshalJSON() ([]byte, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return json.Marshal(fc.entries)
+}
+
+func (fc *Cache) UnmarshalJSON(data []byte) error {
+	entries := map[string]cacheEntry{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.entries = entries
+	return nil
+}
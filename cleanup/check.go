@@ -0,0 +1,1293 @@
+package cleanup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func parseFeed(url string, r io.Reader) (*gofeed.Feed, error) {
+	fp := gofeed.NewParser()
+	feed, err := fp.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+// DefaultAccept is the default Accept header. Some CDNs respond with 406
+// Not Acceptable to requests without one.
+const DefaultAccept = "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8"
+
+// DefaultUserAgent is the default User-Agent header. Some hosts reject
+// requests without one.
+const DefaultUserAgent = "opml-cleanup/1.0"
+
+// DefaultFeedContentTypes are the media types that count as a feed in
+// strict mode unless Checker.FeedContentTypes is set
+var DefaultFeedContentTypes = []string{
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/rdf+xml",
+	"application/feed+json",
+	"application/json",
+	"application/xml",
+	"text/xml",
+}
+
+// Checker checks the feeds of OPML documents. The zero value checks
+// feeds with the default options.
+type Checker struct {
+	// Client is used for all requests. If nil a client with Timeout is
+	// used.
+	Client *http.Client
+	// Timeout limits the time of each request if Client is nil, the
+	// default is 30 seconds
+	Timeout time.Duration
+	// Concurrency is the number of feeds checked in parallel, the
+	// default is 10
+	Concurrency int
+	// MaxRedirects is the maximum number of redirects followed for a
+	// request, the default is 10. Feeds with more redirects or a
+	// redirect loop fail with a RedirectError. It is only used if the
+	// CheckRedirect of the Client is nil.
+	MaxRedirects int
+	// Method is how feeds are checked: "head" only sends a HEAD request,
+	// "get" downloads and parses the feed, and "auto" tries a HEAD
+	// request first. The default is "get".
+	Method string
+	// Retries is the number of times a feed is retried on connection
+	// errors and responses with a status in RetryStatus (default
+	// 500-599), with exponential backoff starting at Backoff (default
+	// one second). A Retry-After header of the response replaces the
+	// backoff, up to MaxRetryAfter (default one minute).
+	Retries       int
+	Backoff       time.Duration
+	RetryStatus   StatusRanges
+	MaxRetryAfter time.Duration
+	// UserAgent is sent with every request, the default is
+	// DefaultUserAgent
+	UserAgent string
+	// Accept is the Accept header sent with every request, the default
+	// is DefaultAccept
+	Accept string
+	// OKStatus are the status codes that count as success, the default
+	// is 200-299
+	OKStatus StatusRanges
+	// MaxAge marks feeds whose newest item is older as stale if non-zero
+	MaxAge time.Duration
+	// Strict fails responses that are html pages or feeds without a type
+	// or title
+	Strict bool
+	// FeedContentTypes are the media types that count as a feed in
+	// strict mode, the default is DefaultFeedContentTypes. Responses with
+	// another type still pass if they parse as a feed, except html pages.
+	FeedContentTypes []string
+	// MinItems fails feeds with fewer items
+	MinItems int
+	// MaxBody is the maximum size of a decoded response body in bytes,
+	// 0 for no limit
+	MaxBody int64
+	// Header holds extra headers sent with every request
+	Header http.Header
+	// BasicAuth holds "user:pass" credentials sent with every request.
+	// Check fails if there is no colon.
+	BasicAuth string
+	// PerHostDelay is the minimum time between requests to the same host
+	PerHostDelay time.Duration
+	// Jitter delays the check of every feed by a random duration up to
+	// Jitter to spread out the load. The delays are derived from Seed
+	// and the url, a Seed of 0 is replaced with a random one.
+	Jitter time.Duration
+	Seed   int64
+	// Shuffle checks the feeds in a random order derived from Seed, so
+	// feeds on the same host aren't checked one after another. The
+	// results are still in document order.
+	Shuffle bool
+	// Cache holds validators for conditional requests, nil if disabled
+	Cache *Cache
+	// DetectParked fails feeds whose response looks like a parked domain
+	DetectParked bool
+	// Autodiscover checks the feed linked from html pages returned for
+	// a feed url
+	Autodiscover bool
+	// CheckEnclosure sends a HEAD request for the newest enclosure of
+	// each feed and sets DeadEnclosure if it is gone. The feed is not
+	// failed.
+	CheckEnclosure bool
+	// CheckHTMLURL sends a HEAD request to the site url of each feed and
+	// sets HTMLStatus and HTMLErr. The feed is only failed if the site
+	// is dead and RequireHTMLURL is set, which implies CheckHTMLURL.
+	CheckHTMLURL   bool
+	RequireHTMLURL bool
+	// StripQuery fetches feeds whose url has a query again without it,
+	// and sets Stripped if the feed is the same. It needs the feed to be
+	// downloaded, so it doesn't work with the "head" Method.
+	StripQuery bool
+	// UseAlternates tries the urls in the AltURL of an outline if its
+	// feed url fails and sets Alternate to the first one that works
+	UseAlternates bool
+	// PreferHTTPS tries the https variant of http feed urls first
+	PreferHTTPS bool
+	// Previous returns the result of an earlier check of a feed. If it
+	// returns true the result is used instead of checking the feed
+	// again.
+	Previous func(Outline) (FeedResult, bool)
+	// QuietSuccess disables the log line for every feed that was checked
+	// successfully, so only failed and skipped feeds are logged
+	QuietSuccess bool
+	// Validator is called for every feed that was fetched and parsed
+	// and passed the other checks. If it returns false the feed fails
+	// with a ValidationError with the returned reason. It is called
+	// from multiple goroutines.
+	Validator func(*gofeed.Feed, *http.Response) (bool, string)
+	// OnResult is called for every checked feed as soon as it's done.
+	// It is called from a single goroutine.
+	OnResult func(FeedResult)
+
+	// limiter spaces out requests to the same host, nil if disabled
+	limiter *hostLimiter
+}
+
+// Check checks all feeds of opml. If ctx is done before all feeds are
+// checked, the remaining feeds are skipped and the results are returned
+// together with the error of ctx.
+func (c *Checker) Check(ctx context.Context, opml Opml) (Result, error) {
+	cc := *c
+	if cc.Client == nil {
+		timeout := cc.Timeout
+		if timeout == 0 {
+			timeout = 30 * time.Second
+		}
+		cc.Client = &http.Client{Timeout: timeout}
+	}
+	if cc.Concurrency == 0 {
+		cc.Concurrency = 10
+	}
+	if cc.MaxRedirects == 0 {
+		cc.MaxRedirects = 10
+	}
+	if cc.Client.CheckRedirect == nil {
+		client := *cc.Client
+		client.CheckRedirect = cc.checkRedirect
+		cc.Client = &client
+	}
+	if cc.Concurrency < 0 {
+		return Result{}, fmt.Errorf("invalid concurrency %d", cc.Concurrency)
+	}
+	if cc.BasicAuth != "" && !strings.Contains(cc.BasicAuth, ":") {
+		return Result{}, fmt.Errorf("invalid basic auth, must be user:pass")
+	}
+	switch cc.Method {
+	case "":
+		cc.Method = "get"
+	case "get", "head", "auto":
+	default:
+		return Result{}, fmt.Errorf("invalid method %q", cc.Method)
+	}
+	if cc.UserAgent == "" {
+		cc.UserAgent = DefaultUserAgent
+	}
+	if cc.Accept == "" {
+		cc.Accept = DefaultAccept
+	}
+	if cc.Backoff == 0 {
+		cc.Backoff = time.Second
+	}
+	if cc.RetryStatus == nil {
+		cc.RetryStatus = StatusRanges{{from: 500, to: 599}}
+	}
+	if cc.MaxRetryAfter == 0 {
+		cc.MaxRetryAfter = time.Minute
+	}
+	if cc.FeedContentTypes == nil {
+		cc.FeedContentTypes = DefaultFeedContentTypes
+	}
+	if cc.OKStatus == nil {
+		cc.OKStatus = StatusRanges{{from: 200, to: 299}}
+	}
+	if cc.PerHostDelay > 0 {
+		cc.limiter = newHostLimiter(cc.PerHostDelay)
+	}
+	if cc.Seed == 0 {
+		cc.Seed = time.Now().UnixNano()
+	}
+
+	result := cc.checkFeeds(ctx, CollectFeeds(opml.Body.Outline))
+	return result, ctx.Err()
+}
+
+// StatusError is returned when a feed responds with a status that isn't
+// accepted
+type StatusError struct {
+	URL    string
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("\"%s\": status %d", RedactURL(e.URL), e.Status)
+}
+
+// TimeoutError is returned when a request times out. Timeout is set if
+// the client timeout was exceeded, otherwise Err is the timeout error of
+// the transport, e.g. of the connection.
+type TimeoutError struct {
+	URL     string
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Timeout > 0 {
+		return fmt.Sprintf("\"%s\": timed out after %s", RedactURL(e.URL), e.Timeout)
+	}
+	return fmt.Sprintf("\"%s\": timed out (%s)", RedactURL(e.URL), e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// NotFeedError is returned in strict mode when a response is not a feed
+type NotFeedError struct {
+	URL    string
+	Reason string
+}
+
+func (e *NotFeedError) Error() string {
+	return fmt.Sprintf("\"%s\": not a feed (%s)", RedactURL(e.URL), e.Reason)
+}
+
+// EmptyFeedError is returned when a feed has fewer than MinItems items
+type EmptyFeedError struct {
+	URL   string
+	Items int
+}
+
+func (e *EmptyFeedError) Error() string {
+	return fmt.Sprintf("\"%s\": empty feed (%d items)", RedactURL(e.URL), e.Items)
+}
+
+// ParseError is returned when a response can't be parsed as a feed
+type ParseError struct {
+	URL string
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("\"%s\": %s", RedactURL(e.URL), e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParkedError is returned when a response looks like the page of a
+// parked domain
+type ParkedError struct {
+	URL    string
+	Reason string
+}
+
+func (e *ParkedError) Error() string {
+	return fmt.Sprintf("\"%s\": parked domain (%s)", RedactURL(e.URL), e.Reason)
+}
+
+// TooLargeError is returned when a response body is larger than MaxBody
+type TooLargeError struct {
+	URL   string
+	Limit int64
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("\"%s\": response too large (more than %d bytes)", RedactURL(e.URL), e.Limit)
+}
+
+// RedirectError is returned when a request is redirected more than
+// MaxRedirects times or in a loop
+type RedirectError struct {
+	URL  string
+	Loop bool
+	// Redirects is the number of redirects followed
+	Redirects int
+}
+
+func (e *RedirectError) Error() string {
+	if e.Loop {
+		return fmt.Sprintf("\"%s\": redirect loop after %d redirects", RedactURL(e.URL), e.Redirects)
+	}
+	return fmt.Sprintf("\"%s\": too many redirects (more than %d)", RedactURL(e.URL), e.Redirects)
+}
+
+// ValidationError is returned when the Validator of a Checker rejects a
+// feed
+type ValidationError struct {
+	URL    string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("\"%s\": rejected: %s", RedactURL(e.URL), e.Reason)
+}
+
+// InvalidURLError is returned for feed urls that can't be requested
+type InvalidURLError struct {
+	URL    string
+	Reason string
+}
+
+func (e *InvalidURLError) Error() string {
+	return fmt.Sprintf("\"%s\": invalid URL: %s", RedactURL(e.URL), e.Reason)
+}
+
+// TLSError is returned when the TLS handshake fails, e.g. because of an
+// invalid certificate
+type TLSError struct {
+	URL string
+	Err error
+}
+
+func (e *TLSError) Error() string {
+	return fmt.Sprintf("\"%s\": TLS error: %s", RedactURL(e.URL), e.Err)
+}
+
+func (e *TLSError) Unwrap() error {
+	return e.Err
+}
+
+// checkRedirect is the CheckRedirect function of the client. It stops
+// after MaxRedirects redirects or when a url is visited twice.
+func (c *Checker) checkRedirect(req *http.Request, via []*http.Request) error {
+	chain := []string{}
+	for _, r := range via {
+		chain = append(chain, RedactURL(r.URL.String()))
+	}
+	chain = append(chain, RedactURL(req.URL.String()))
+	debugf("redirected: %s", strings.Join(chain, " -> "))
+	for _, r := range via {
+		if r.URL.String() == req.URL.String() {
+			return &RedirectError{URL: via[0].URL.String(), Loop: true, Redirects: len(via)}
+		}
+	}
+	if len(via) > c.MaxRedirects {
+		return &RedirectError{URL: via[0].URL.String(), Redirects: c.MaxRedirects}
+	}
+	return nil
+}
+
+// requestError wraps an error returned by the HTTP client, replacing
+// timeouts and TLS errors with clearer messages
+func (c *Checker) requestError(url string, err error) error {
+	var rerr *RedirectError
+	if errors.As(err, &rerr) {
+		return rerr
+	}
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		if strings.Contains(err.Error(), "Client.Timeout exceeded") {
+			return &TimeoutError{URL: url, Timeout: c.Client.Timeout, Err: err}
+		}
+		var uerr *neturl.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return &TimeoutError{URL: url, Err: err}
+	}
+	if isTLSError(err) {
+		var uerr *neturl.Error
+		if errors.As(err, &uerr) {
+			return &TLSError{URL: url, Err: uerr.Err}
+		}
+		return &TLSError{URL: url, Err: err}
+	}
+	return err
+}
+
+// isTLSError reports whether err was caused by the TLS handshake or
+// certificate verification
+func isTLSError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var header tls.RecordHeaderError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) ||
+		errors.As(err, &invalid) || errors.As(err, &header) {
+		return true
+	}
+	return strings.Contains(err.Error(), "tls: ")
+}
+
+// retryable reports whether err may be caused by a transient problem,
+// like a connection error or a server error, and is worth retrying
+func (c *Checker) retryable(err error) bool {
+	var serr *StatusError
+	if errors.As(err, &serr) {
+		return c.RetryStatus.contains(serr.Status)
+	}
+	var terr *TimeoutError
+	var uerr *neturl.Error
+	return errors.As(err, &terr) || errors.As(err, &uerr)
+}
+
+// fetch is the outcome of a single attempt at checking a feed
+type fetch struct {
+	// resp is the last response received. Its body is already closed.
+	resp *http.Response
+	// feed is the parsed feed, nil unless the feed was downloaded
+	feed *gofeed.Feed
+	// discovered is the url of the feed linked from an html page
+	discovered string
+	// elapsed is the time it took to fetch and parse the feed
+	elapsed time.Duration
+}
+
+// NewRequest returns a request with the User-Agent, Accept, Header and
+// BasicAuth of c, like the requests for feeds. Other files, e.g. a remote
+// OPML, can be fetched with it.
+func (c *Checker) NewRequest(ctx context.Context, method, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	userAgent := c.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if c.Accept != "" {
+		req.Header.Set("Accept", c.Accept)
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	// credentials in the url take precedence
+	if c.BasicAuth != "" && req.URL.User == nil {
+		creds := strings.SplitN(c.BasicAuth, ":", 2)
+		if len(creds) != 2 {
+			return nil, fmt.Errorf("invalid basic auth, must be user:pass")
+		}
+		req.SetBasicAuth(creds[0], creds[1])
+	}
+	return req, nil
+}
+
+// do sends a request with the given method to url
+func (c *Checker) do(ctx context.Context, method, url string) (*http.Response, error) {
+	req, err := c.NewRequest(ctx, method, url)
+	if err != nil {
+		return nil, err
+	}
+	// setting this disables the transparent decompression of the
+	// transport, so the body is decoded by decodeBody. An Accept-Encoding
+	// in Header takes precedence.
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+	}
+	if method == http.MethodGet && c.Cache != nil {
+		if e, ok := c.Cache.get(url); ok {
+			if e.ETag != "" {
+				req.Header.Set("If-None-Match", e.ETag)
+			}
+			if e.LastModified != "" {
+				req.Header.Set("If-Modified-Since", e.LastModified)
+			}
+		}
+	}
+	if c.limiter != nil {
+		if err := c.limiter.wait(ctx, req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+	debugf("%s %s %v", method, RedactURL(url), RedactHeader(req.Header))
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		debugf("%s %s: %s", method, RedactURL(url), err)
+		return nil, c.requestError(url, err)
+	}
+	debugf("%s %s: %s %v", method, RedactURL(url), resp.Status, resp.Header)
+	return resp, nil
+}
+
+// getFeed fetches the feed, parses it and returns a Feed
+func (c *Checker) getFeed(ctx context.Context, url string) (fetch, error) {
+	// remember where the response came from to detect parking services
+	var remoteIP net.IP
+	if c.DetectParked {
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				if addr, ok := info.Conn.RemoteAddr().(*net.TCPAddr); ok {
+					remoteIP = addr.IP
+				}
+			},
+		})
+	}
+
+	// fetch xml from remote
+	resp, err := c.do(ctx, http.MethodGet, url)
+	if err != nil {
+		return fetch{}, err
+	}
+	defer drainAndClose(resp.Body)
+
+	// the feed hasn't changed since the last successful check
+	if resp.StatusCode == http.StatusNotModified && c.Cache != nil {
+		debugf("%s: not modified", RedactURL(url))
+		return fetch{resp: resp}, nil
+	}
+
+	// if the status is not accepted the feed doesn't exist
+	if !c.OKStatus.contains(resp.StatusCode) {
+		return fetch{resp: resp}, &StatusError{URL: url, Status: resp.StatusCode}
+	}
+
+	body, err := decodeBody(resp)
+	if err != nil {
+		return fetch{resp: resp}, fmt.Errorf("\"%s\": %s", RedactURL(url), err)
+	}
+	defer body.Close()
+
+	// stop reading huge responses
+	var r io.Reader = body
+	var limited *limitReader
+	if c.MaxBody > 0 {
+		limited = &limitReader{r: body, n: c.MaxBody}
+		r = limited
+	}
+
+	// parked domains often answer with a 200 OK page and html pages may
+	// link to the actual feed, so the body has to be looked at before
+	// parsing it
+	if c.DetectParked || c.Autodiscover {
+		data, err := ioutil.ReadAll(r)
+		if limited != nil && limited.exceeded {
+			return fetch{resp: resp}, &TooLargeError{URL: url, Limit: c.MaxBody}
+		}
+		if err != nil {
+			return fetch{resp: resp}, fmt.Errorf("\"%s\": %s", RedactURL(url), err)
+		}
+		if c.DetectParked {
+			if reason := parkedReason(resp, remoteIP, data); reason != "" {
+				return fetch{resp: resp}, &ParkedError{URL: url, Reason: reason}
+			}
+		}
+		if c.Autodiscover && isHTML(resp, data) {
+			if link := discoverFeed(resp.Request.URL, data); link != "" {
+				return fetch{resp: resp, discovered: link}, &NotFeedError{URL: url, Reason: "html page linking to " + RedactURL(link)}
+			}
+		}
+		r = bytes.NewReader(data)
+	}
+
+	// reject html pages before trying to parse them
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	feedType := c.isFeedType(mediaType)
+	if c.Strict && !feedType && (mediaType == "text/html" || mediaType == "application/xhtml+xml") {
+		return fetch{resp: resp}, &NotFeedError{URL: url, Reason: "got " + mediaType}
+	}
+
+	// parse feed to check if it's valid
+	feed, err := parseFeed(url, r)
+	if limited != nil && limited.exceeded {
+		return fetch{resp: resp}, &TooLargeError{URL: url, Limit: c.MaxBody}
+	}
+	if err != nil && c.Strict && !feedType {
+		if mediaType == "" {
+			mediaType = "no content type"
+		}
+		return fetch{resp: resp}, &NotFeedError{URL: url, Reason: "got " + mediaType}
+	}
+	if err != nil {
+		return fetch{resp: resp}, &ParseError{URL: url, Err: err}
+	}
+	if c.Strict && !feedType {
+		debugf("%s: feed served as %q", RedactURL(url), mediaType)
+	}
+	if c.Strict {
+		if feed.FeedType == "" {
+			return fetch{resp: resp}, &NotFeedError{URL: url, Reason: "unknown feed type"}
+		}
+		if feed.Title == "" {
+			return fetch{resp: resp}, &NotFeedError{URL: url, Reason: "no title"}
+		}
+	}
+
+	if len(feed.Items) < c.MinItems {
+		return fetch{resp: resp, feed: feed}, &EmptyFeedError{URL: url, Items: len(feed.Items)}
+	}
+	if c.Validator != nil {
+		if ok, reason := c.Validator(feed, resp); !ok {
+			return fetch{resp: resp, feed: feed}, &ValidationError{URL: url, Reason: reason}
+		}
+	}
+
+	if c.Cache != nil {
+		c.Cache.set(url, cacheEntry{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		})
+	}
+
+	return fetch{resp: resp, feed: feed}, nil
+}
+
+// isFeedType reports whether mediaType is one of the FeedContentTypes
+func (c *Checker) isFeedType(mediaType string) bool {
+	for _, t := range c.FeedContentTypes {
+		if strings.EqualFold(t, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitReader reads at most n bytes from r and fails with
+// errTooLarge if there are more
+type limitReader struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+var errTooLarge = errors.New("response too large")
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, errTooLarge
+	}
+	// read one byte more than allowed to find out if there are more
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.n {
+		l.exceeded = true
+		return int(l.n), errTooLarge
+	}
+	l.n -= int64(n)
+	return n, err
+}
+
+// decodeBody returns a reader for the body of resp that decompresses it
+// according to its Content-Encoding
+func decodeBody(resp *http.Response) (io.ReadCloser, error) {
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(resp.Body)
+	case "deflate":
+		// deflate should be zlib wrapped but some servers send raw
+		// deflate data, so check for a zlib header first
+		br := bufio.NewReader(resp.Body)
+		header, err := br.Peek(2)
+		if err != nil {
+			return nil, err
+		}
+		if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	}
+	return ioutil.NopCloser(resp.Body), nil
+}
+
+// headFeed sends a HEAD request for the feed
+func (c *Checker) headFeed(ctx context.Context, url string) (fetch, error) {
+	resp, err := c.do(ctx, http.MethodHead, url)
+	if err != nil {
+		return fetch{}, err
+	}
+	drainAndClose(resp.Body)
+	return fetch{resp: resp}, nil
+}
+
+// permanentRedirect returns the final url of resp if every redirect that
+// led to it was permanent (301 or 308), or an empty string otherwise
+func permanentRedirect(resp *http.Response) string {
+	if resp == nil || resp.Request.Response == nil {
+		return ""
+	}
+	for req := resp.Request; req.Response != nil; req = req.Response.Request {
+		status := req.Response.StatusCode
+		if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+			return ""
+		}
+	}
+	return resp.Request.URL.String()
+}
+
+// checkFeed checks the feed at url, retrying transient failures up to
+// c.Retries times with exponential backoff
+func (c *Checker) checkFeed(ctx context.Context, url string) (fetch, error) {
+	attempts := 0
+	for {
+		attempts++
+		f, err := c.checkOnce(ctx, url)
+		if err == nil {
+			return f, nil
+		}
+		if ctx.Err() != nil {
+			return f, err
+		}
+		if attempts > c.Retries || !c.retryable(err) {
+			if attempts > 1 {
+				return f, fmt.Errorf("%w (%d attempts)", err, attempts)
+			}
+			return f, err
+		}
+		delay := c.Backoff << (attempts - 1)
+		if f.resp != nil {
+			if d, ok := parseRetryAfter(f.resp.Header.Get("Retry-After"), time.Now()); ok {
+				if d > c.MaxRetryAfter {
+					debugf("%s: Retry-After %s is longer than %s", RedactURL(url), d, c.MaxRetryAfter)
+					d = c.MaxRetryAfter
+				}
+				delay = d
+			}
+		}
+		warnf("%s, retrying in %s", err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return f, err
+		}
+	}
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is
+// either a number of seconds or an HTTP date
+func parseRetryAfter(h string, now time.Time) (time.Duration, bool) {
+	if h == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(h); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(h)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// checkOnce checks that the feed at url is reachable using the configured
+// method. With "head" only a HEAD request is made, with "get" the feed is
+// downloaded and parsed, and with "auto" a HEAD request is tried first
+// and the feed is only downloaded if the HEAD request isn't successful.
+func (c *Checker) checkOnce(ctx context.Context, url string) (f fetch, err error) {
+	start := time.Now()
+	defer func() {
+		f.elapsed = time.Since(start)
+		debugf("%s: checked in %s", RedactURL(url), f.elapsed)
+	}()
+
+	switch c.Method {
+	case "head":
+		f, err = c.headFeed(ctx, url)
+		if err != nil {
+			return f, err
+		}
+		if status := f.resp.StatusCode; !c.OKStatus.contains(status) {
+			return f, &StatusError{URL: url, Status: status}
+		}
+		return f, nil
+	case "auto":
+		f, err = c.headFeed(ctx, url)
+		if err == nil && c.OKStatus.contains(f.resp.StatusCode) {
+			return f, nil
+		}
+	}
+	return c.getFeed(ctx, url)
+}
+
+// job is an outline waiting to be checked together with its
+// position in the input
+type job struct {
+	index int
+	entry Outline
+}
+
+// FeedResult is the outcome of checking a single feed
+type FeedResult struct {
+	// Index is the position of the feed in the document, as used by
+	// FilterOutlines
+	Index int
+	Entry Outline
+	// Err is the reason the check failed, nil if the feed is ok
+	Err error
+	// StatusCode is the HTTP status of the last response, 0 if none
+	StatusCode int
+	// Duration is the time the last attempt took to fetch and parse
+	// the feed. Earlier attempts and the waits between retries aren't
+	// included.
+	Duration time.Duration
+	// MovedTo is the new url of a feed that was permanently redirected
+	MovedTo string
+	// Updated is the date of the newest item, zero if unknown
+	Updated time.Time
+	// Stale is set for feeds whose newest item is older than MaxAge
+	Stale bool
+	// Skipped is set for feeds whose check was cancelled
+	Skipped bool
+	// Reused is set for results returned by Checker.Previous
+	Reused bool
+	// DeadEnclosure is the url of the newest enclosure if it responded
+	// with 404 or 410, only set with CheckEnclosure
+	DeadEnclosure string
+	// FeedTitle is the title of the parsed feed
+	FeedTitle string
+	// FeedType is the type of the parsed feed: "rss", "atom" or "json"
+	FeedType string
+	// ContentHash is a hash of the title and item ids of the parsed
+	// feed, the same for urls that serve the same feed. Empty for feeds
+	// without items.
+	ContentHash string
+	// Upgraded is the https url of a http feed that could be fetched
+	// over https
+	Upgraded string
+	// Discovered is the url of the feed linked from the html page at
+	// the feed url
+	Discovered string
+	// Fixed is the url with the scheme that was used for a feed url
+	// without a scheme
+	Fixed string
+	// Stripped is the feed url, or MovedTo if set, without its query.
+	// Only set with StripQuery if it returns the same feed.
+	Stripped string
+	// Alternate is the mirror url from AltURL that was used because the
+	// feed url failed
+	Alternate string
+	// HTMLStatus is the HTTP status of the site url, and HTMLErr the
+	// reason its check failed. Only set with CheckHTMLURL.
+	HTMLStatus int
+	HTMLErr    error
+}
+
+// Result holds the results of all checked feeds, each in document order
+type Result struct {
+	// Kept holds the feeds that were fetched and parsed successfully
+	Kept []FeedResult
+	// Failed holds the feeds whose check failed
+	Failed []FeedResult
+	// Skipped holds the feeds that weren't checked because the context
+	// was done
+	Skipped []FeedResult
+}
+
+// All returns the results of all feeds in document order
+func (r Result) All() []FeedResult {
+	all := append(append(append([]FeedResult{}, r.Kept...), r.Failed...), r.Skipped...)
+	sortResults(all)
+	return all
+}
+
+// checkEntry checks the feed of a single outline
+func (c *Checker) checkEntry(ctx context.Context, j job) FeedResult {
+	if c.Previous != nil {
+		if r, ok := c.Previous(j.entry); ok {
+			r.Index = j.index
+			r.Entry = j.entry
+			r.Reused = true
+			return r
+		}
+	}
+	if j.entry.Timeout != "" {
+		if d, err := time.ParseDuration(j.entry.Timeout); err != nil || d <= 0 {
+			warnf("%s: ignoring invalid x-timeout %q", RedactURL(j.entry.XmlURL), j.entry.Timeout)
+		} else {
+			// a copy of the client shares its transport
+			client := *c.Client
+			client.Timeout = d
+			cc := *c
+			cc.Client = &client
+			c = &cc
+		}
+	}
+
+	if c.Jitter > 0 {
+		if err := sleep(ctx, jitter(c.Jitter, c.Seed, j.entry.XmlURL)); err != nil {
+			return FeedResult{Index: j.index, Entry: j.entry, Skipped: true}
+		}
+	}
+	url, schemeless, err := parseFeedURL(j.entry.XmlURL)
+	if err != nil {
+		return FeedResult{Index: j.index, Entry: j.entry, Err: err}
+	}
+	// urls without a scheme are tried with https first, like with
+	// PreferHTTPS
+	if schemeless {
+		infof("%s: no scheme, assuming https with http as fallback", RedactURL(j.entry.XmlURL))
+	}
+
+	var f fetch
+	upgraded := ""
+	if secure := httpsURL(url); (c.PreferHTTPS || schemeless) && secure != "" {
+		// a single attempt, the retries are left for the original url
+		f, err = c.checkOnce(ctx, secure)
+		if err == nil {
+			upgraded = secure
+		} else {
+			debugf("%s: https failed: %s", RedactURL(url), err)
+		}
+	}
+	if upgraded == "" {
+		f, err = c.checkFeed(ctx, url)
+	}
+	fixed := ""
+	if schemeless {
+		fixed = url
+		if upgraded != "" {
+			fixed, upgraded = upgraded, ""
+		}
+	}
+	discovered := ""
+	if link := f.discovered; err != nil && link != "" && ctx.Err() == nil {
+		infof("%s: trying discovered feed %s", RedactURL(j.entry.XmlURL), RedactURL(link))
+		df, derr := c.checkFeed(ctx, link)
+		if derr == nil {
+			f, err, discovered = df, nil, link
+		} else {
+			debugf("%s: %s", RedactURL(link), derr)
+		}
+	}
+	alternate := ""
+	if c.UseAlternates && err != nil && ctx.Err() == nil {
+		for _, alt := range strings.FieldsFunc(j.entry.AltURL, func(r rune) bool { return r == ',' || r == ' ' }) {
+			infof("%s: trying alternate %s", RedactURL(j.entry.XmlURL), RedactURL(alt))
+			af, aerr := c.checkFeed(ctx, alt)
+			if aerr == nil {
+				f, err, alternate = af, nil, alt
+				break
+			}
+			debugf("%s: %s", RedactURL(alt), aerr)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	r := FeedResult{
+		Index:    j.index,
+		Entry:    j.entry,
+		Err:      err,
+		MovedTo:  permanentRedirect(f.resp),
+		Upgraded: upgraded,
+		Fixed:    fixed,
+
+		Discovered: discovered,
+		Alternate:  alternate,
+		Duration:   f.elapsed,
+	}
+	// feeds interrupted by the cancellation haven't really failed
+	if err != nil && ctx.Err() != nil {
+		r.Skipped = true
+		return r
+	}
+
+	// the site of a feed can move without the feed breaking, and the
+	// other way around
+	if (c.CheckHTMLURL || c.RequireHTMLURL) && j.entry.HtmlURL != "" {
+		r.HTMLStatus, r.HTMLErr = c.checkSite(ctx, j.entry.HtmlURL)
+		switch {
+		case ctx.Err() != nil:
+			r.HTMLStatus, r.HTMLErr = 0, nil
+		case r.HTMLErr != nil && err == nil && c.RequireHTMLURL:
+			err = fmt.Errorf("site link: %w", r.HTMLErr)
+			r.Err = err
+		case r.HTMLErr != nil && err == nil:
+			warnf("%s", Colorize(Yellow, fmt.Sprintf("%s: feed works but the site link is dead: %s", RedactURL(j.entry.XmlURL), r.HTMLErr)))
+		case r.HTMLErr == nil && err != nil:
+			infof("%s: feed failed but the site link works", RedactURL(j.entry.XmlURL))
+		}
+	}
+	if f.resp != nil {
+		r.StatusCode = f.resp.StatusCode
+	}
+	if f.feed != nil {
+		r.FeedTitle = strings.TrimSpace(f.feed.Title)
+		r.FeedType = f.feed.FeedType
+		r.ContentHash = contentHash(f.feed)
+	}
+
+	// flag feeds that haven't been updated in a long time
+	if err == nil && c.MaxAge > 0 && f.feed != nil {
+		r.Updated = latestItem(f.feed)
+		if r.Updated.IsZero() {
+			infof("%s: no dated items", RedactURL(j.entry.XmlURL))
+		} else if time.Since(r.Updated) > c.MaxAge {
+			r.Stale = true
+		}
+	}
+
+	// the feed of a podcast can outlive the hosting of its media
+	if err == nil && c.CheckEnclosure && f.feed != nil {
+		if enclosure := latestEnclosure(f.feed); enclosure != "" {
+			resp, err := c.do(ctx, http.MethodHead, enclosure)
+			if err != nil {
+				debugf("%s: %s", RedactURL(enclosure), err)
+			} else {
+				drainAndClose(resp.Body)
+				if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+					r.DeadEnclosure = enclosure
+				}
+			}
+		}
+	}
+
+	// tracking parameters can be dropped, but some feeds need their
+	// query, so the feed without it has to be the same. Only the url
+	// that ends up in the document is stripped, the target of a
+	// temporary redirect is left alone.
+	if err == nil && c.StripQuery && f.feed != nil {
+		req := f.resp.Request
+		if r.MovedTo == "" {
+			for req.Response != nil {
+				req = req.Response.Request
+			}
+		}
+		if u := req.URL; u.RawQuery != "" {
+			stripped := *u
+			stripped.RawQuery = ""
+			sf, serr := c.getFeed(ctx, stripped.String())
+			switch {
+			case serr != nil:
+				debugf("%s: without query: %s", RedactURL(u.String()), serr)
+			case !sameFeed(f.feed, sf.feed):
+				debugf("%s: without query the feed is different", RedactURL(u.String()))
+			default:
+				r.Stripped = stripped.String()
+			}
+		}
+	}
+	return r
+}
+
+// sameFeed reports whether a and b look like the same feed
+func sameFeed(a, b *gofeed.Feed) bool {
+	if a.Title != b.Title || a.Link != b.Link || len(a.Items) != len(b.Items) {
+		return false
+	}
+	if len(a.Items) > 0 {
+		return a.Items[0].GUID == b.Items[0].GUID && a.Items[0].Link == b.Items[0].Link
+	}
+	return true
+}
+
+// contentHash returns a hash of the title and item ids of feed. Items
+// without a GUID use their link instead. Feeds without items return ""
+// since there's nothing to tell them apart.
+func contentHash(feed *gofeed.Feed) string {
+	if len(feed.Items) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	io.WriteString(h, strings.TrimSpace(feed.Title))
+	for _, item := range feed.Items {
+		id := item.GUID
+		if id == "" {
+			id = item.Link
+		}
+		io.WriteString(h, "\n"+strings.TrimSpace(id))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// checkSite checks the site url of a feed with a HEAD request, falling
+// back to GET for servers that don't support HEAD, and returns the status
+func (c *Checker) checkSite(ctx context.Context, url string) (int, error) {
+	resp, err := c.do(ctx, http.MethodHead, url)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		drainAndClose(resp.Body)
+		resp, err = c.do(ctx, http.MethodGet, url)
+	}
+	if err != nil {
+		return 0, err
+	}
+	drainAndClose(resp.Body)
+	if !c.OKStatus.contains(resp.StatusCode) {
+		return resp.StatusCode, &StatusError{URL: url, Status: resp.StatusCode}
+	}
+	return resp.StatusCode, nil
+}
+
+// latestEnclosure returns the url of the first enclosure of the newest
+// item that has one. Without dates the first such item is used, since
+// feeds usually list the newest items first.
+func latestEnclosure(feed *gofeed.Feed) string {
+	url := ""
+	latest := time.Time{}
+	for _, item := range feed.Items {
+		if len(item.Enclosures) == 0 || item.Enclosures[0].URL == "" {
+			continue
+		}
+		date := time.Time{}
+		for _, t := range []*time.Time{item.UpdatedParsed, item.PublishedParsed} {
+			if t != nil && t.After(date) {
+				date = *t
+			}
+		}
+		if url == "" || date.After(latest) {
+			url = item.Enclosures[0].URL
+			latest = date
+		}
+	}
+	return url
+}
+
+// httpsURL returns the https variant of the http url raw, or "" if raw
+// isn't a http url
+func httpsURL(raw string) string {
+	u, err := neturl.Parse(raw)
+	if err != nil || u.Scheme != "http" {
+		return ""
+	}
+	u.Scheme = "https"
+	return u.String()
+}
+
+// latestItem returns the published or updated date of the newest item in
+// feed, or the zero time if no item has a date
+func latestItem(feed *gofeed.Feed) time.Time {
+	latest := time.Time{}
+	for _, item := range feed.Items {
+		for _, t := range []*time.Time{item.UpdatedParsed, item.PublishedParsed} {
+			if t != nil && t.After(latest) {
+				latest = *t
+			}
+		}
+	}
+	return latest
+}
+
+// logResult logs a line with the outcome of a checked feed. The lines are
+// logged when the checks finish, so with concurrent checks the indexes
+// aren't in order.
+func (c *Checker) logResult(r FeedResult, numFeeds int) {
+	name := r.Entry.Title
+	if name == "" {
+		name = RedactURL(r.Entry.XmlURL)
+	}
+	prefix := fmt.Sprintf("[%d/%d]", r.Index+1, numFeeds)
+	switch {
+	case r.Skipped:
+		infof("%s %s %s", prefix, Colorize(Yellow, "SKIP"), name)
+	case r.Err != nil:
+		warnf("%s %s %s: %s", prefix, Colorize(Red, "FAIL"), name, r.Err)
+	case !c.QuietSuccess:
+		infof("%s %s %s", prefix, Colorize(Green, "OK"), name)
+	}
+}
+
+// checkFeeds checks every entry using c.Concurrency workers and returns
+// the results in the order the entries appear in entries. When ctx is
+// done no more feeds are checked, in-flight requests are aborted, and all
+// feeds that weren't checked completely are skipped.
+func (c *Checker) checkFeeds(ctx context.Context, entries []Outline) Result {
+	numFeeds := len(entries)
+	jobs := make(chan job)
+	results := make(chan FeedResult)
+
+	var wg sync.WaitGroup
+	for w := 0; w < c.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results <- c.checkEntry(ctx, j)
+			}
+		}()
+	}
+
+	order := make([]int, numFeeds)
+	for i := range order {
+		order[i] = i
+	}
+	if c.Shuffle {
+		rand.New(rand.NewSource(c.Seed)).Shuffle(numFeeds, func(i, j int) {
+			order[i], order[j] = order[j], order[i]
+		})
+	}
+	go func() {
+		for _, i := range order {
+			entry := entries[i]
+			select {
+			case jobs <- job{index: i, entry: entry}:
+			case <-ctx.Done():
+				// don't start any more checks
+				results <- FeedResult{Index: i, Entry: entry, Skipped: true}
+			}
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// results arrive in the order the checks finish, store them at
+	// their index to get back the input order
+	byIndex := make([]FeedResult, numFeeds)
+	for r := range results {
+		c.logResult(r, numFeeds)
+		if !r.Skipped && c.OnResult != nil {
+			c.OnResult(r)
+		}
+		byIndex[r.Index] = r
+	}
+
+	var res Result
+	for _, r := range byIndex {
+		switch {
+		case r.Skipped:
+			res.Skipped = append(res.Skipped, r)
+		case r.Err != nil:
+			res.Failed = append(res.Failed, r)
+		default:
+			res.Kept = append(res.Kept, r)
+		}
+	}
+	return res
+}
+
+// sortResults orders results by their original index
+func sortResults(results []FeedResult) {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Index < results[j].Index
+	})
+}
+
+// maxDrain is the maximum number of bytes read from an unused response
+// body so the connection can be reused. Connections with larger bodies
+// are closed instead.
+const maxDrain = 64 << 10
+
+// drainAndClose reads the rest of body and closes it, allowing the
+// transport to reuse the connection
+func drainAndClose(body io.ReadCloser) {
+	io.CopyN(ioutil.Discard, body, maxDrain)
+	body.Close()
+}
@@ -0,0 +1,366 @@
+package cleanup
+
+import (
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+  <channel>
+    <title>Test feed</title>
+    <link>https://example.com/</link>
+    <item>
+      <title>First post</title>
+      <guid>https://example.com/1</guid>
+      <pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate>
+    </item>
+  </channel>
+</rss>
+`
+
+// newTestServer returns a server with handlers for the kinds of responses
+// feeds give
+func newTestServer(t testing.TB) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, testFeed)
+	})
+	mux.HandleFunc("/404", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/500", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/feed.xml", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/found", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/feed.xml", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<!DOCTYPE html><html><body>Not a feed</body></html>")
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testDocument returns a document with a feed for each url
+func testDocument(urls ...string) Opml {
+	outlines := []Outline{}
+	for _, u := range urls {
+		outlines = append(outlines, Outline{Text: u, XmlURL: u})
+	}
+	return Opml{Version: "2.0", Body: Body{Outline: outlines}}
+}
+
+// quiet disables logging for the duration of a test
+func quiet(t testing.TB) {
+	SetLogLevel(LevelQuiet)
+	t.Cleanup(func() { SetLogLevel(LevelInfo) })
+}
+
+func TestCheck(t *testing.T) {
+	quiet(t)
+	srv := newTestServer(t)
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr interface{}
+		movedTo string
+	}{
+		{name: "ok", path: "/feed.xml"},
+		{name: "not found", path: "/404", wantErr: new(*StatusError)},
+		{name: "server error", path: "/500", wantErr: new(*StatusError)},
+		{name: "timeout", path: "/slow", wantErr: new(*TimeoutError)},
+		{name: "permanent redirect", path: "/moved", movedTo: srv.URL + "/feed.xml"},
+		{name: "temporary redirect", path: "/found"},
+		{name: "redirect loop", path: "/loop", wantErr: new(*RedirectError)},
+		{name: "not a feed", path: "/page.html", wantErr: new(*ParseError)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Checker{Client: &http.Client{Timeout: 200 * time.Millisecond}}
+			res, err := c.Check(context.Background(), testDocument(srv.URL+tt.path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			all := res.All()
+			if len(all) != 1 {
+				t.Fatalf("got %d results, want 1", len(all))
+			}
+			r := all[0]
+			if tt.wantErr == nil {
+				if r.Err != nil {
+					t.Fatalf("unexpected error: %s", r.Err)
+				}
+			} else if !errors.As(r.Err, tt.wantErr) {
+				t.Fatalf("got error %v, want %T", r.Err, tt.wantErr)
+			}
+			if r.MovedTo != tt.movedTo {
+				t.Errorf("got MovedTo %q, want %q", r.MovedTo, tt.movedTo)
+			}
+		})
+	}
+}
+
+func BenchmarkCheck(b *testing.B) {
+	quiet(b)
+	srv := newTestServer(b)
+	urls := []string{}
+	for i := 0; i < 100; i++ {
+		urls = append(urls, fmt.Sprintf("%s/feed.xml?n=%d", srv.URL, i))
+	}
+	doc := testDocument(urls...)
+
+	for _, concurrency := range []int{1, 10, 50} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			c := Checker{Client: srv.Client(), Concurrency: concurrency}
+			for i := 0; i < b.N; i++ {
+				res, err := c.Check(context.Background(), doc)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(res.Failed) > 0 {
+					b.Fatal(res.Failed[0].Err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCheckKeepAlive checks feeds on a single https host with and
+// without connection reuse, so every check without it does a TLS
+// handshake
+func BenchmarkCheckKeepAlive(b *testing.B) {
+	quiet(b)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testFeed)
+	}))
+	b.Cleanup(srv.Close)
+	urls := []string{}
+	for i := 0; i < 100; i++ {
+		urls = append(urls, fmt.Sprintf("%s/feed.xml?n=%d", srv.URL, i))
+	}
+	doc := testDocument(urls...)
+
+	for _, keepAlive := range []bool{true, false} {
+		for _, concurrency := range []int{1, 10} {
+			b.Run(fmt.Sprintf("keepalive=%v/concurrency=%d", keepAlive, concurrency), func(b *testing.B) {
+				transport := srv.Client().Transport.(*http.Transport).Clone()
+				transport.DisableKeepAlives = !keepAlive
+				transport.MaxIdleConnsPerHost = concurrency
+				c := Checker{Client: &http.Client{Transport: transport}, Concurrency: concurrency}
+				for i := 0; i < b.N; i++ {
+					res, err := c.Check(context.Background(), doc)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if len(res.Failed) > 0 {
+						b.Fatal(res.Failed[0].Err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCheckBasicAuthWithoutColon(t *testing.T) {
+	quiet(t)
+	srv := newTestServer(t)
+	c := Checker{Client: srv.Client(), BasicAuth: "token"}
+	if _, err := c.Check(context.Background(), testDocument(srv.URL+"/feed.xml")); err == nil {
+		t.Fatal("expected an error for credentials without a colon")
+	}
+}
+
+func TestCheckCompressed(t *testing.T) {
+	quiet(t)
+	gzipped, err := ioutil.ReadFile("testdata/feed.xml.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gzipped)
+	})
+	mux.HandleFunc("/deflate", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "deflate")
+		zw := zlib.NewWriter(w)
+		io.WriteString(zw, testFeed)
+		zw.Close()
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for _, path := range []string{"/gzip", "/deflate"} {
+		c := Checker{Client: srv.Client()}
+		res, err := c.Check(context.Background(), testDocument(srv.URL+path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := res.All()[0]
+		if r.Err != nil {
+			t.Errorf("%s: %s", path, r.Err)
+		} else if r.FeedTitle != "Test feed" {
+			t.Errorf("%s: got title %q", path, r.FeedTitle)
+		}
+	}
+}
+
+func TestCheckKeepsOrder(t *testing.T) {
+	quiet(t)
+	// answer in a different order than the requests were sent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		fmt.Sscan(r.URL.Query().Get("n"), &n)
+		time.Sleep(time.Duration(n*7%10) * time.Millisecond)
+		if n%3 == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, testFeed)
+	}))
+	defer srv.Close()
+
+	urls := []string{}
+	for i := 0; i < 60; i++ {
+		urls = append(urls, fmt.Sprintf("%s/feed.xml?n=%d", srv.URL, i))
+	}
+	c := Checker{Client: srv.Client(), Concurrency: 20}
+	res, err := c.Check(context.Background(), testDocument(urls...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{}
+	for i, u := range urls {
+		if i%3 != 0 {
+			want = append(want, u)
+		}
+	}
+	if len(res.Kept) != len(want) {
+		t.Fatalf("kept %d feeds, want %d", len(res.Kept), len(want))
+	}
+	for i, r := range res.Kept {
+		if r.Entry.XmlURL != want[i] {
+			t.Fatalf("kept feed %d is %s, want %s", i, r.Entry.XmlURL, want[i])
+		}
+	}
+	for i, r := range res.All() {
+		if r.Index != i {
+			t.Fatalf("result %d has index %d", i, r.Index)
+		}
+	}
+}
+
+func TestCheckAcceptHeader(t *testing.T) {
+	quiet(t)
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Accept")
+		fmt.Fprint(w, testFeed)
+	}))
+	defer srv.Close()
+
+	for _, accept := range []string{"", "application/atom+xml"} {
+		c := Checker{Client: srv.Client(), Accept: accept}
+		if _, err := c.Check(context.Background(), testDocument(srv.URL)); err != nil {
+			t.Fatal(err)
+		}
+		want := accept
+		if want == "" {
+			want = DefaultAccept
+		}
+		if got != want {
+			t.Errorf("got Accept %q, want %q", got, want)
+		}
+	}
+}
+
+func TestCheckStripQuery(t *testing.T) {
+	quiet(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testFeed)
+	})
+	mux.HandleFunc("/found", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/feed.xml?utm=1", http.StatusFound)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/feed.xml?utm=1", http.StatusMovedPermanently)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		path     string
+		stripped string
+	}{
+		{path: "/feed.xml?utm=1", stripped: srv.URL + "/feed.xml"},
+		{path: "/feed.xml"},
+		// the query of a temporary redirect isn't in the document
+		{path: "/found"},
+		{path: "/moved", stripped: srv.URL + "/feed.xml"},
+	}
+	for _, tt := range tests {
+		c := Checker{Client: srv.Client(), StripQuery: true}
+		res, err := c.Check(context.Background(), testDocument(srv.URL+tt.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := res.All()[0]
+		if r.Err != nil {
+			t.Fatalf("%s: %s", tt.path, r.Err)
+		}
+		if r.Stripped != tt.stripped {
+			t.Errorf("%s: got Stripped %q, want %q", tt.path, r.Stripped, tt.stripped)
+		}
+	}
+}
+
+func TestCheckUserAgent(t *testing.T) {
+	quiet(t)
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+		fmt.Fprint(w, testFeed)
+	}))
+	defer srv.Close()
+
+	for _, ua := range []string{"", "reader/2.0"} {
+		c := Checker{UserAgent: ua}
+		if _, err := c.Check(context.Background(), testDocument(srv.URL)); err != nil {
+			t.Fatal(err)
+		}
+		want := ua
+		if want == "" {
+			want = DefaultUserAgent
+		}
+		if got != want {
+			t.Errorf("got User-Agent %q, want %q", got, want)
+		}
+	}
+}
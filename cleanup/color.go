@@ -0,0 +1,28 @@
+package cleanup
+
+// Color is a terminal color used to highlight log messages
+type Color string
+
+const (
+	Red    Color = "31"
+	Green  Color = "32"
+	Yellow Color = "33"
+)
+
+// colorEnabled reports whether log messages are colored
+var colorEnabled = false
+
+// SetColor enables or disables colored log messages. They are disabled
+// by default, enable them only when logging to a terminal.
+func SetColor(enabled bool) {
+	colorEnabled = enabled
+}
+
+// Colorize wraps s in the escape codes for c if colored log messages are
+// enabled
+func Colorize(c Color, s string) string {
+	if !colorEnabled {
+		return s
+	}
+	return "\x1b[" + string(c) + "m" + s + "\x1b[0m"
+}
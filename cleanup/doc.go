@@ -0,0 +1,15 @@
+// Package cleanup checks the feeds of OPML documents and removes the ones
+// that can't be fetched or parsed.
+//
+// A Checker checks all feeds of a document:
+//
+//	opml, err := cleanup.ReadOpml(r)
+//	c := &cleanup.Checker{Concurrency: 20}
+//	result, err := c.Check(ctx, opml)
+//
+// All requests are sent with the Client of the Checker, so it can be
+// pointed at a test server, e.g. with httptest.Server.Client.
+//
+// The results are indexed in document order, so FilterOutlines can be
+// used to build a new document from them that keeps the categories.
+package cleanup
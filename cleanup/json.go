@@ -0,0 +1,34 @@
+package cleanup
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// jsonFeed is an entry of a JSON subscription list
+type jsonFeed struct {
+	Title   string `json:"title"`
+	XmlURL  string `json:"xmlUrl"`
+	HtmlURL string `json:"htmlUrl"`
+}
+
+// ReadJSON parses a JSON array of feeds with the fields title, xmlUrl
+// and htmlUrl, all of which are optional. The feeds are returned as the
+// outlines of an OPML document with an empty head.
+func ReadJSON(r io.Reader) (Opml, error) {
+	var feeds []jsonFeed
+	if err := json.NewDecoder(r).Decode(&feeds); err != nil {
+		return Opml{}, err
+	}
+	opml := Opml{}
+	for _, f := range feeds {
+		opml.Body.Outline = append(opml.Body.Outline, Outline{
+			Text:    f.Title,
+			Title:   f.Title,
+			Type:    "rss",
+			HtmlURL: f.HtmlURL,
+			XmlURL:  f.XmlURL,
+		})
+	}
+	return opml, nil
+}
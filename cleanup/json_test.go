@@ -0,0 +1,46 @@
+package cleanup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadJSON(t *testing.T) {
+	input := `[
+  {"title": "Blog", "xmlUrl": "https://example.com/feed", "htmlUrl": "https://example.com/"},
+  {"xmlUrl": "https://example.org/rss"},
+  {"title": "No url"},
+  {}
+]`
+	doc, err := ReadJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Outline{
+		{Text: "Blog", Title: "Blog", Type: "rss", HtmlURL: "https://example.com/", XmlURL: "https://example.com/feed"},
+		{Type: "rss", XmlURL: "https://example.org/rss"},
+		{Text: "No url", Title: "No url", Type: "rss"},
+		{Type: "rss"},
+	}
+	if len(doc.Body.Outline) != len(want) {
+		t.Fatalf("got %d outlines, want %d", len(doc.Body.Outline), len(want))
+	}
+	for i, o := range doc.Body.Outline {
+		w := want[i]
+		if o.Text != w.Text || o.Title != w.Title || o.Type != w.Type || o.HtmlURL != w.HtmlURL || o.XmlURL != w.XmlURL {
+			t.Errorf("outline %d: got %+v, want %+v", i, o, w)
+		}
+	}
+	// entries without a url aren't feeds
+	if n := CountFeeds(doc.Body.Outline); n != 2 {
+		t.Errorf("got %d feeds, want 2", n)
+	}
+}
+
+func TestReadJSONInvalid(t *testing.T) {
+	for _, input := range []string{``, `{"title": "not an array"}`, `[{"xmlUrl": 1}]`, `[`} {
+		if _, err := ReadJSON(strings.NewReader(input)); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package cleanup
+
+import (
+	"fmt"
+	"log"
+)
+
+// LogLevel controls which messages are logged. Messages are written with
+// the standard log package.
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelQuiet
+)
+
+// currentLevel is the minimum level of messages that are logged
+var currentLevel = LevelInfo
+
+// SetLogLevel sets the minimum level of messages that are logged. The
+// default is LevelInfo.
+func SetLogLevel(level LogLevel) {
+	currentLevel = level
+}
+
+// ParseLogLevel parses the name of a log level
+func ParseLogLevel(s string) (LogLevel, error) {
+	switch s {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	case "quiet":
+		return LevelQuiet, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// Logf logs a message if level is at least the current level
+func Logf(level LogLevel, format string, args ...interface{}) {
+	if level >= currentLevel {
+		log.Printf(format, args...)
+	}
+}
+
+// debugf logs details like HTTP requests and responses
+func debugf(format string, args ...interface{}) {
+	Logf(LevelDebug, format, args...)
+}
+
+// infof logs progress messages
+func infof(format string, args ...interface{}) {
+	Logf(LevelInfo, format, args...)
+}
+
+// warnf logs problems with single feeds
+func warnf(format string, args ...interface{}) {
+	Logf(LevelWarn, format, args...)
+}
@@ -0,0 +1,253 @@
+package cleanup
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Outline is a feed or a category of feeds
+type Outline struct {
+	XMLName     xml.Name `xml:"outline"`
+	Text        string   `xml:"text,attr"`
+	Title       string   `xml:"title,attr"`
+	Description string   `xml:"description,attr"`
+	Type        string   `xml:"type,attr"`
+	Version     string   `xml:"version,attr"`
+	HtmlURL     string   `xml:"htmlUrl,attr"`
+	XmlURL      string   `xml:"xmlUrl,attr"`
+	// Status and StatusError mark failed feeds that were kept
+	Status      string `xml:"status,attr,omitempty"`
+	StatusError string `xml:"statusError,attr,omitempty"`
+	// Timeout overrides the timeout of the Checker for this feed, e.g.
+	// "60s"
+	Timeout string `xml:"x-timeout,attr,omitempty"`
+	// AltURL holds space or comma-separated mirror urls of the feed
+	AltURL  string    `xml:"x-alt-url,attr,omitempty"`
+	Outline []Outline `xml:"outline"`
+	// Attrs holds all other attributes so they are kept in the output
+	Attrs []xml.Attr `xml:",any,attr"`
+}
+
+// Head holds the metadata of an OPML document
+type Head struct {
+	XMLName      xml.Name `xml:"head"`
+	Title        string   `xml:"title"`
+	DateCreated  string   `xml:"dateCreated"`
+	DateModified string   `xml:"dateModified,omitempty"`
+	OwnerName    string   `xml:"ownerName,omitempty"`
+	OwnerEmail   string   `xml:"ownerEmail,omitempty"`
+	// Extra holds all other elements so they are kept in the output
+	Extra []HeadElement `xml:",any"`
+}
+
+// HeadElement is an element of the head like ownerName or docs
+type HeadElement struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// opml2Elements are the head elements that were added in OPML 2.0
+var opml2Elements = map[string]bool{"ownerId": true, "docs": true}
+
+// Body holds the outlines of an OPML document
+type Body struct {
+	XMLName xml.Name  `xml:"body"`
+	Outline []Outline `xml:"outline"`
+}
+
+// Opml is an OPML document
+type Opml struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    Head
+	Body    Body
+	// Extra holds unknown elements next to the head and body so they
+	// can be kept in the output
+	Extra []Element `xml:",any"`
+}
+
+// Element is an unknown element that is kept as it is
+type Element struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
+}
+
+// SyntaxError is returned by ReadOpml for documents that aren't valid
+// XML
+type SyntaxError struct {
+	// Line is the line of the error, starting at 1
+	Line int
+	// Offset is the byte offset of the error in the input
+	Offset int64
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, byte %d: %s", e.Line, e.Offset, e.Msg)
+}
+
+// ReadOpml reads an OPML document from r. Malformed documents result in
+// a *SyntaxError. The outlines of documents with more than one body are
+// merged into one, and unknown top-level elements end up in Extra. Both
+// are logged as warnings since other tools may not handle them.
+func ReadOpml(r io.Reader) (Opml, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Opml{}, err
+	}
+	// some exports start with a BOM or whitespace before the XML
+	// declaration, which the decoder rejects
+	trimmed := bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	trimmed = bytes.TrimLeft(trimmed, " \t\r\n")
+	skipped := len(data) - len(trimmed)
+
+	opml := Opml{}
+	d := xml.NewDecoder(bytes.NewReader(trimmed))
+	if err := d.Decode(&opml); err != nil {
+		var serr *xml.SyntaxError
+		if errors.As(err, &serr) {
+			line := serr.Line + bytes.Count(data[:skipped], []byte("\n"))
+			return Opml{}, &SyntaxError{Line: line, Offset: d.InputOffset() + int64(skipped), Msg: serr.Msg}
+		}
+		return Opml{}, err
+	}
+	for _, e := range opml.Extra {
+		warnf("unknown element <%s> in the document, keeping it as it is", e.XMLName.Local)
+	}
+	var bodies struct {
+		Body []struct{} `xml:"body"`
+	}
+	if err := xml.Unmarshal(trimmed, &bodies); err == nil && len(bodies.Body) > 1 {
+		warnf("the document has %d bodies, merging their outlines", len(bodies.Body))
+	}
+	return opml, nil
+}
+
+// CreateOpml returns a new OPML document of the given version containing
+// feeds. The head is copied from the original document, with defaults for
+// empty fields and dateModified set to now. The version defaults to 2.0,
+// for older versions the head elements added in 2.0 are dropped.
+func CreateOpml(version string, head Head, feeds []Outline) Opml {
+	if version == "" {
+		version = "2.0"
+	}
+	if head.Title == "" {
+		head.Title = "feeds"
+	}
+	if head.DateCreated == "" {
+		head.DateCreated = time.Now().Format(time.RFC822)
+	}
+	head.DateModified = time.Now().Format(time.RFC822)
+	if version != "2.0" {
+		extra := []HeadElement{}
+		for _, e := range head.Extra {
+			if !opml2Elements[e.XMLName.Local] {
+				extra = append(extra, e)
+			}
+		}
+		head.Extra = extra
+	}
+	newOpml := Opml{
+		Version: version,
+		Head:    head,
+		Body: Body{
+			Outline: feeds,
+		},
+	}
+	return newOpml
+}
+
+// CollectFeeds returns all outlines in the tree that have a feed URL,
+// in document order
+func CollectFeeds(outlines []Outline) []Outline {
+	feeds := []Outline{}
+	for _, o := range outlines {
+		if o.XmlURL != "" {
+			feeds = append(feeds, o)
+		} else if len(o.Outline) == 0 {
+			debugf("not a feed, keeping it: %s", o.Text)
+		}
+		feeds = append(feeds, CollectFeeds(o.Outline)...)
+	}
+	return feeds
+}
+
+// CountFeeds returns the number of outlines in the tree that have a feed URL
+func CountFeeds(outlines []Outline) int {
+	n := 0
+	for _, o := range outlines {
+		if o.XmlURL != "" {
+			n++
+		}
+		n += CountFeeds(o.Outline)
+	}
+	return n
+}
+
+// FilterOutlines returns a copy of the outline tree containing only the
+// feeds for which keep returns true. keep is called with the position of
+// the feed in document order, as returned by CollectFeeds, and may modify
+// the outline. Outlines that are neither feeds nor categories, like notes,
+// are kept unchanged, and categories left without children are dropped if
+// prune is set.
+func FilterOutlines(outlines []Outline, prune bool, keep func(index int, o *Outline) bool) []Outline {
+	next := 0
+	return filterTree(outlines, prune, keep, &next)
+}
+
+// filterTree implements FilterOutlines, using next to track the position
+// of feeds across the recursion
+func filterTree(outlines []Outline, prune bool, keep func(int, *Outline) bool, next *int) []Outline {
+	kept := []Outline{}
+	for _, o := range outlines {
+		isFeed := o.XmlURL != ""
+		if isFeed {
+			index := *next
+			*next++
+			if !keep(index, &o) {
+				// skip the children as well but keep the count in sync
+				*next += CountFeeds(o.Outline)
+				continue
+			}
+		}
+		if len(o.Outline) > 0 {
+			o.Outline = filterTree(o.Outline, prune, keep, next)
+			if !isFeed && len(o.Outline) == 0 && prune {
+				continue
+			}
+		}
+		kept = append(kept, o)
+	}
+	return kept
+}
+
+// SortOutlines sorts outlines and the children of each category in place.
+// by is "title" to sort case-insensitively by title or "url" to sort by
+// feed url. The sort is stable so outlines with the same key keep their
+// order.
+func SortOutlines(outlines []Outline, by string) {
+	key := func(o Outline) string {
+		if by == "url" {
+			return o.XmlURL
+		}
+		title := o.Title
+		if title == "" {
+			title = o.Text
+		}
+		return strings.ToLower(title)
+	}
+	sort.SliceStable(outlines, func(i, j int) bool {
+		return key(outlines[i]) < key(outlines[j])
+	})
+	for i := range outlines {
+		SortOutlines(outlines[i].Outline, by)
+	}
+}
@@ -0,0 +1,174 @@
+package cleanup
+
+import (
+	"encoding/xml"
+	"os"
+	"strings"
+	"testing"
+)
+
+// attrs returns the attributes of the first outline element in data
+func attrs(t *testing.T, data string) map[string]string {
+	t.Helper()
+	d := xml.NewDecoder(strings.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			t.Fatalf("no outline: %s", err)
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "outline" {
+			m := map[string]string{}
+			for _, a := range se.Attr {
+				m[a.Name.Local] = a.Value
+			}
+			return m
+		}
+	}
+}
+
+func TestOutlineAttributesRoundTrip(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <head><title>feeds</title></head>
+  <body>
+    <outline text="Blog" title="Blog" type="rss" xmlUrl="https://example.com/feed" htmlUrl="https://example.com/" category="/tech,/news" created="Mon, 02 Jan 2006 15:04:05 GMT" isComment="false" x-app-id="42"/>
+  </body>
+</opml>`
+	doc, err := ReadOpml(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := xml.Marshal(CreateOpml(doc.Version, doc.Head, doc.Body.Outline))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := attrs(t, input)
+	got := attrs(t, string(output))
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("attribute %s: got %q, want %q", name, got[name], value)
+		}
+	}
+}
+
+func TestReadOpmlBOM(t *testing.T) {
+	f, err := os.Open("testdata/bom.opml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	doc, err := ReadOpml(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Head.Title != "bom" || CountFeeds(doc.Body.Outline) != 1 {
+		t.Errorf("got title %q and %d feeds", doc.Head.Title, CountFeeds(doc.Body.Outline))
+	}
+}
+
+func TestVersionRoundTrip(t *testing.T) {
+	tests := []struct {
+		version     string
+		wantVersion string
+		wantDocs    bool
+	}{
+		{version: "1.0", wantVersion: "1.0", wantDocs: false},
+		{version: "1.1", wantVersion: "1.1", wantDocs: false},
+		{version: "2.0", wantVersion: "2.0", wantDocs: true},
+		{version: "", wantVersion: "2.0", wantDocs: true},
+	}
+	for _, tt := range tests {
+		input := `<opml version="` + tt.version + `">
+  <head>
+    <title>feeds</title>
+    <ownerName>Jane</ownerName>
+    <docs>http://opml.org/spec2.opml</docs>
+  </head>
+  <body><outline text="Blog" xmlUrl="https://example.com/feed"/></body>
+</opml>`
+		doc, err := ReadOpml(strings.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := xml.Marshal(CreateOpml(doc.Version, doc.Head, doc.Body.Outline))
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := ReadOpml(strings.NewReader(string(output)))
+		if err != nil {
+			t.Fatalf("version %q: reading the output: %s", tt.version, err)
+		}
+		if again.Version != tt.wantVersion {
+			t.Errorf("version %q: got version %q, want %q", tt.version, again.Version, tt.wantVersion)
+		}
+		if again.Head.OwnerName != "Jane" {
+			t.Errorf("version %q: lost the owner name", tt.version)
+		}
+		if got := strings.Contains(string(output), "<docs>"); got != tt.wantDocs {
+			t.Errorf("version %q: docs element kept is %v, want %v", tt.version, got, tt.wantDocs)
+		}
+		if CountFeeds(again.Body.Outline) != 1 {
+			t.Errorf("version %q: lost the feed", tt.version)
+		}
+	}
+}
+
+func TestCreateOpml(t *testing.T) {
+	feeds := []Outline{{Text: "Blog", XmlURL: "https://example.com/feed"}}
+
+	created := "Mon, 02 Jan 2006 15:04:05 GMT"
+	doc := CreateOpml("2.0", Head{Title: "my feeds", DateCreated: created, OwnerName: "Jane"}, feeds)
+	if doc.Head.Title != "my feeds" || doc.Head.DateCreated != created || doc.Head.OwnerName != "Jane" {
+		t.Errorf("head not preserved: %+v", doc.Head)
+	}
+	if doc.Head.DateModified == "" {
+		t.Error("dateModified not set")
+	}
+	if len(doc.Body.Outline) != 1 || doc.Body.Outline[0].XmlURL != feeds[0].XmlURL {
+		t.Errorf("got outlines %+v", doc.Body.Outline)
+	}
+
+	doc = CreateOpml("", Head{}, feeds)
+	if doc.Version != "2.0" {
+		t.Errorf("got version %q, want 2.0", doc.Version)
+	}
+	if doc.Head.Title != "feeds" {
+		t.Errorf("got title %q, want feeds", doc.Head.Title)
+	}
+	if doc.Head.DateCreated == "" {
+		t.Error("dateCreated not set")
+	}
+}
+
+func TestFilterOutlinesKeepsNotes(t *testing.T) {
+	input := `<opml version="2.0">
+  <head><title>feeds</title></head>
+  <body>
+    <outline text="Read these first"/>
+    <outline text="Tech">
+      <outline text="Blog" xmlUrl="https://example.com/feed"/>
+      <outline text="Comment about this folder"/>
+    </outline>
+    <outline text="Dead" xmlUrl="https://dead.example/feed"/>
+  </body>
+</opml>`
+	doc, err := ReadOpml(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(CollectFeeds(doc.Body.Outline)); n != 2 {
+		t.Fatalf("got %d feeds, want 2", n)
+	}
+
+	for _, prune := range []bool{false, true} {
+		// remove every feed
+		kept := FilterOutlines(doc.Body.Outline, prune, func(int, *Outline) bool { return false })
+		if len(kept) != 2 || kept[0].Text != "Read these first" || kept[1].Text != "Tech" {
+			t.Fatalf("prune %v: got %+v", prune, kept)
+		}
+		if children := kept[1].Outline; len(children) != 1 || children[0].Text != "Comment about this folder" {
+			t.Errorf("prune %v: got children %+v", prune, children)
+		}
+	}
+}
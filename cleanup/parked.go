@@ -0,0 +1,100 @@
+package cleanup
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// parkingHosts are the domains of domain parking and sale services.
+// Subdomains match as well.
+var parkingHosts = []string{
+	"above.com",
+	"afternic.com",
+	"bodis.com",
+	"dan.com",
+	"domainmarket.com",
+	"hugedomains.com",
+	"parkingcrew.net",
+	"parklogic.com",
+	"sedo.com",
+	"sedoparking.com",
+	"undeveloped.com",
+}
+
+// parkingNets are address ranges of parking services
+var parkingNets = mustParseCIDRs(
+	"91.195.240.0/23", // Sedo
+	"199.59.240.0/22", // Bodis
+)
+
+// parkingPhrases are lowercase phrases found on parking pages
+var parkingPhrases = []string{
+	"buy this domain",
+	"this domain is for sale",
+	"this domain may be for sale",
+	"the domain name is for sale",
+	"domain is parked",
+	"parked free, courtesy of",
+	"inquire about this domain",
+}
+
+var metaRefresh = regexp.MustCompile(`(?is)<meta[^>]+http-equiv=["']?refresh["']?[^>]+url=([^"'>\s]+)`)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := []*net.IPNet{}
+	for _, s := range cidrs {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// isParkingHost reports whether host belongs to a parking service
+func isParkingHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, p := range parkingHosts {
+		if host == p || strings.HasSuffix(host, "."+p) {
+			return true
+		}
+	}
+	return false
+}
+
+// parkedReason returns why the response looks like a parked domain, or an
+// empty string if it doesn't. ip is the address the response came from,
+// nil if unknown, and body the decoded response body.
+func parkedReason(resp *http.Response, ip net.IP, body []byte) string {
+	if host := resp.Request.URL.Hostname(); isParkingHost(host) {
+		return "redirected to " + host
+	}
+	if ip != nil {
+		for _, n := range parkingNets {
+			if n.Contains(ip) {
+				return "parking address " + ip.String()
+			}
+		}
+	}
+
+	// feeds may well talk about domains for sale, only look at html pages
+	if !isHTML(resp, body) {
+		return ""
+	}
+	if m := metaRefresh.FindSubmatch(body); m != nil {
+		if u, err := resp.Request.URL.Parse(string(m[1])); err == nil && isParkingHost(u.Hostname()) {
+			return "refresh to " + u.Hostname()
+		}
+	}
+	lower := bytes.ToLower(body)
+	for _, phrase := range parkingPhrases {
+		if bytes.Contains(lower, []byte(phrase)) {
+			return "page says \"" + phrase + "\""
+		}
+	}
+	return ""
+}
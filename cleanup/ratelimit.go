@@ -0,0 +1,62 @@
+package cleanup
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// hostLimiter spaces out requests to the same host. It is safe for
+// concurrent use.
+type hostLimiter struct {
+	delay time.Duration
+	mu    sync.Mutex
+	next  map[string]time.Time
+}
+
+func newHostLimiter(delay time.Duration) *hostLimiter {
+	return &hostLimiter{delay: delay, next: map[string]time.Time{}}
+}
+
+// wait blocks until a request to host may be sent, at least l.delay
+// after the previous request to the same host, or until ctx is done
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[host] = at.Add(l.delay)
+	l.mu.Unlock()
+
+	if d := time.Until(at); d > 0 {
+		debugf("waiting %s for %s", d, host)
+		return sleep(ctx, d)
+	}
+	return nil
+}
+
+// jitter returns a delay between 0 and max for the check of the feed at
+// url. The delay only depends on seed and url, so runs with the same seed
+// use the same delays.
+func jitter(max time.Duration, seed int64, url string) time.Duration {
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, seed)
+	h.Write([]byte(url))
+	return time.Duration(h.Sum64() % uint64(max))
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,60 @@
+package cleanup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// statusRange is an inclusive range of HTTP status codes
+type statusRange struct {
+	from, to int
+}
+
+// StatusRanges is a set of HTTP status codes
+type StatusRanges []statusRange
+
+// ParseStatusRanges parses a comma-separated list of status codes and
+// ranges like "200,203,301-308"
+func ParseStatusRanges(s string) (StatusRanges, error) {
+	ranges := StatusRanges{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		from, to := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			from, to = part[:i], part[i+1:]
+		}
+		r := statusRange{}
+		var err error
+		if r.from, err = parseStatus(from); err != nil {
+			return nil, err
+		}
+		if r.to, err = parseStatus(to); err != nil {
+			return nil, err
+		}
+		if r.from > r.to {
+			return nil, fmt.Errorf("invalid status range %q", part)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// parseStatus parses a single HTTP status code
+func parseStatus(s string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || code < 100 || code > 599 {
+		return 0, fmt.Errorf("invalid status code %q", s)
+	}
+	return code, nil
+}
+
+// contains reports whether code is in one of the ranges
+func (r StatusRanges) contains(code int) bool {
+	for _, sr := range r {
+		if code >= sr.from && code <= sr.to {
+			return true
+		}
+	}
+	return false
+}
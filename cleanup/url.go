@@ -0,0 +1,56 @@
+package cleanup
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RedactURL returns raw with the password replaced by "xxxxx" so it can
+// be logged
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+// RedactHeader returns a copy of h with credentials removed so it can be
+// logged
+func RedactHeader(h http.Header) http.Header {
+	redacted := h.Clone()
+	for _, name := range []string{"Authorization", "Proxy-Authorization"} {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, "[redacted]")
+		}
+	}
+	return redacted
+}
+
+// parseFeedURL checks that raw is a http or https url with a host and
+// returns it. Urls without a scheme, like "//example.com/feed" or
+// "example.com/feed", are returned with http and schemeless set.
+func parseFeedURL(raw string) (feedURL string, schemeless bool, err error) {
+	s := strings.TrimSpace(raw)
+	if !strings.Contains(s, "://") {
+		s = "http://" + strings.TrimPrefix(s, "//")
+		schemeless = true
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return "", false, &InvalidURLError{URL: raw, Reason: err.Error()}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false, &InvalidURLError{URL: raw, Reason: "unsupported scheme " + u.Scheme}
+	}
+	if u.Host == "" {
+		return "", false, &InvalidURLError{URL: raw, Reason: "missing host"}
+	}
+	return s, schemeless, nil
+}
@@ -0,0 +1,63 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParseFeedURL(t *testing.T) {
+	tests := []struct {
+		in         string
+		want       string
+		schemeless bool
+		wantErr    bool
+	}{
+		{in: "https://example.com/feed", want: "https://example.com/feed"},
+		{in: "http://example.com/feed", want: "http://example.com/feed"},
+		{in: "  https://example.com/feed ", want: "https://example.com/feed"},
+		{in: "//example.com/feed", want: "http://example.com/feed", schemeless: true},
+		{in: "example.com/feed", want: "http://example.com/feed", schemeless: true},
+		{in: "example.com", want: "http://example.com", schemeless: true},
+		{in: "ftp://example.com/feed", wantErr: true},
+		{in: "https:///feed", wantErr: true},
+		{in: "http://exa mple.com/feed", wantErr: true},
+		{in: "http://[::1/feed", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, schemeless, err := parseFeedURL(tt.in)
+		if tt.wantErr {
+			var ierr *InvalidURLError
+			if !errors.As(err, &ierr) {
+				t.Errorf("parseFeedURL(%q): got error %v, want an InvalidURLError", tt.in, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseFeedURL(%q): %s", tt.in, err)
+			continue
+		}
+		if got != tt.want || schemeless != tt.schemeless {
+			t.Errorf("parseFeedURL(%q) = %q, %v, want %q, %v", tt.in, got, schemeless, tt.want, tt.schemeless)
+		}
+	}
+}
+
+func TestCheckInvalidURL(t *testing.T) {
+	quiet(t)
+	c := Checker{}
+	res, err := c.Check(context.Background(), testDocument("ftp://example.com/feed", "http://[::1/feed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Failed) != 2 {
+		t.Fatalf("got %d failed feeds, want 2", len(res.Failed))
+	}
+	for _, r := range res.Failed {
+		var ierr *InvalidURLError
+		if !errors.As(r.Err, &ierr) {
+			t.Errorf("%s: got error %v, want an InvalidURLError", r.Entry.XmlURL, r.Err)
+		}
+	}
+}
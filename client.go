@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// clientConfig holds the settings of the HTTP client shared by all checks
+type clientConfig struct {
+	// timeout limits the time of a whole request, including connecting
+	// to a proxy
+	timeout time.Duration
+	// connectTimeout limits the time to establish a connection
+	connectTimeout time.Duration
+	// responseHeaderTimeout limits the time to wait for the response
+	// headers after sending the request, 0 for no limit
+	responseHeaderTimeout time.Duration
+	// proxy is the url of a HTTP or SOCKS5 proxy. If empty the proxy is
+	// taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+	// variables.
+	proxy string
+	// insecure disables the verification of TLS certificates
+	insecure bool
+	// minTLS is the minimum TLS version, 0 for the default
+	minTLS uint16
+	// maxIdleConns, maxIdleConnsPerHost and idleConnTimeout control how
+	// many connections are kept open for reuse
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+	// network is the network used to dial, "tcp" for both IPv4 and
+	// IPv6, "tcp4" or "tcp6"
+	network string
+	// dnsCacheTTL enables caching of DNS lookups for the given duration
+	// if non-zero
+	dnsCacheTTL time.Duration
+	// resolver is the ip:port of a DNS server used instead of the
+	// system resolver if non-empty
+	resolver string
+}
+
+// newClient returns a HTTP client for cfg
+func newClient(cfg clientConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if cfg.proxy != "" {
+		u, err := url.Parse(cfg.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %s", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	network := cfg.network
+	if network == "" {
+		network = "tcp"
+	}
+	dialer := &net.Dialer{
+		Timeout:   cfg.connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	resolver := net.DefaultResolver
+	if cfg.resolver != "" {
+		addr := cfg.resolver
+		if net.ParseIP(addr) != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid resolver %q, must be ip:port", cfg.resolver)
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		}
+		dialer.Resolver = resolver
+	}
+	if cfg.dnsCacheTTL > 0 {
+		transport.DialContext = newDNSCache(cfg.dnsCacheTTL, resolver).dialContext(dialer, network)
+	} else {
+		transport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	transport.ResponseHeaderTimeout = cfg.responseHeaderTimeout
+	transport.MaxIdleConns = cfg.maxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.maxIdleConnsPerHost
+	transport.IdleConnTimeout = cfg.idleConnTimeout
+	transport.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: cfg.insecure,
+		MinVersion:         cfg.minTLS,
+	}
+	return &http.Client{
+		Timeout:   cfg.timeout,
+		Transport: transport,
+	}, nil
+}
+
+// parseTLSVersion parses a TLS version like "1.2"
+func parseTLSVersion(s string) (uint16, error) {
+	switch s {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q", s)
+}
+
+// parseIPVersion parses the -ip-version flag into a network for dialing
+func parseIPVersion(s string) (string, error) {
+	switch s {
+	case "auto":
+		return "tcp", nil
+	case "4":
+		return "tcp4", nil
+	case "6":
+		return "tcp6", nil
+	}
+	return "", fmt.Errorf("must be auto, 4 or 6")
+}
+
+// parseHeaders parses headers given as "Name: Value"
+func parseHeaders(headers []string) (http.Header, error) {
+	h := http.Header{}
+	for _, line := range headers {
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid header %q", line)
+		}
+		h.Add(strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]))
+	}
+	return h, nil
+}
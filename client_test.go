@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewClientProxy(t *testing.T) {
+	// the stub answers every request itself, so the feed host doesn't
+	// have to exist
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte("ok"))
+	}))
+	defer proxy.Close()
+
+	client, err := newClient(clientConfig{proxy: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get("http://feeds.invalid/rss.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("got body %q, want the response of the proxy", body)
+	}
+	if proxied != "http://feeds.invalid/rss.xml" {
+		t.Errorf("proxy got request for %q", proxied)
+	}
+}
+
+func TestNewClientProxyScheme(t *testing.T) {
+	for _, proxy := range []string{"http://proxy:8080", "https://proxy:8443", "socks5://localhost:1080"} {
+		if _, err := newClient(clientConfig{proxy: proxy}); err != nil {
+			t.Errorf("%s: %s", proxy, err)
+		}
+	}
+	if _, err := newClient(clientConfig{proxy: "ftp://proxy"}); err == nil {
+		t.Error("expected an error for a ftp proxy")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// config is the format of the -config file. Each key sets the default of
+// the flag with the same name, flags given on the command line take
+// precedence.
+type config struct {
+	Input                 []string        `toml:"input"`
+	InputFormat           string          `toml:"input-format"`
+	OwnerName             string          `toml:"owner-name"`
+	OwnerEmail            string          `toml:"owner-email"`
+	Title                 string          `toml:"title"`
+	Output                string          `toml:"output"`
+	Timeout               duration        `toml:"timeout"`
+	ConnectTimeout        duration        `toml:"connect-timeout"`
+	ResponseHeaderTimeout duration        `toml:"response-header-timeout"`
+	Proxy                 string          `toml:"proxy"`
+	PerHostDelay          duration        `toml:"per-host-delay"`
+	Jitter                duration        `toml:"jitter"`
+	Shuffle               bool            `toml:"shuffle"`
+	Seed                  int64           `toml:"seed"`
+	Insecure              bool            `toml:"insecure"`
+	MinTLS                string          `toml:"min-tls"`
+	DNSCache              duration        `toml:"dns-cache"`
+	Resolver              string          `toml:"resolver"`
+	IPVersion             string          `toml:"ip-version"`
+	MaxIdleConns          int             `toml:"max-idle-conns"`
+	MaxIdleConnsPerHost   int             `toml:"max-idle-conns-per-host"`
+	IdleConnTimeout       duration        `toml:"idle-conn-timeout"`
+	MaxBody               int64           `toml:"max-body"`
+	Header                []string        `toml:"header"`
+	BasicAuth             string          `toml:"basic-auth"`
+	Limit                 int             `toml:"limit"`
+	MaxRedirects          int             `toml:"max-redirects"`
+	Concurrency           concurrencyFlag `toml:"concurrency"`
+	Retries               int             `toml:"retries"`
+	RetryStatus           string          `toml:"retry-status"`
+	MaxRetryAfter         duration        `toml:"max-retry-after"`
+	UserAgent             string          `toml:"user-agent"`
+	Accept                string          `toml:"accept"`
+	Strict                bool            `toml:"strict"`
+	FeedContentTypes      string          `toml:"feed-content-types"`
+	MinItems              int             `toml:"min-items"`
+	DetectParked          bool            `toml:"detect-parked"`
+	Autodiscover          bool            `toml:"autodiscover"`
+	OKStatus              string          `toml:"ok-status"`
+	Method                string          `toml:"method"`
+	MaxAge                string          `toml:"max-age"`
+	SlowThreshold         duration        `toml:"slow-threshold"`
+	CheckEnclosure        bool            `toml:"check-enclosure"`
+	CheckHTMLURL          bool            `toml:"check-htmlurl"`
+	RequireHTMLURL        bool            `toml:"require-htmlurl"`
+	RemoveStale           bool            `toml:"remove-stale"`
+	Report                string          `toml:"report"`
+	ReportFile            string          `toml:"report-file"`
+	FailOnError           bool            `toml:"fail-on-error"`
+	FailThreshold         thresholdFlag   `toml:"fail-threshold"`
+	DryRun                bool            `toml:"dry-run"`
+	Cache                 string          `toml:"cache"`
+	State                 string          `toml:"state"`
+	RecheckAfter          duration        `toml:"recheck-after"`
+	Deadline              duration        `toml:"deadline"`
+	Interactive           bool            `toml:"interactive"`
+	KeepFailed            bool            `toml:"keep-failed"`
+	FillTitles            bool            `toml:"fill-titles"`
+	NormalizeType         bool            `toml:"normalize-type"`
+	SyncTitleText         bool            `toml:"sync-title-text"`
+	AllowHosts            []string        `toml:"allow-hosts"`
+	DenyHosts             []string        `toml:"deny-hosts"`
+	UseAlternates         bool            `toml:"use-alternates"`
+	PreferHTTPS           bool            `toml:"prefer-https"`
+	Dedupe                bool            `toml:"dedupe"`
+	DedupeByContent       bool            `toml:"dedupe-by-content"`
+	Diff                  bool            `toml:"diff"`
+	DiffFile              string          `toml:"diff-file"`
+	ListFailed            bool            `toml:"list-failed"`
+	SummaryJSON           bool            `toml:"summary-json"`
+	Webhook               string          `toml:"webhook"`
+	MetricsFile           string          `toml:"metrics-file"`
+	CSVFile               string          `toml:"csv-file"`
+	RecheckFailed         string          `toml:"recheck-failed"`
+	RemovedOutput         string          `toml:"removed-output"`
+	Format                string          `toml:"format"`
+	Indent                string          `toml:"indent"`
+	Compact               bool            `toml:"compact"`
+	XMLEncoding           string          `toml:"xml-encoding"`
+	NoXMLHeader           bool            `toml:"no-xml-header"`
+	StripQuery            bool            `toml:"strip-query"`
+	NormalizeURLs         bool            `toml:"normalize-urls"`
+	Sort                  string          `toml:"sort"`
+	PruneEmpty            bool            `toml:"prune-empty"`
+	QuietSuccess          bool            `toml:"quiet-success"`
+	Progress              bool            `toml:"progress"`
+	NoColor               bool            `toml:"no-color"`
+	TraceFile             string          `toml:"trace-file"`
+	LogLevel              string          `toml:"log-level"`
+}
+
+// duration is a time.Duration written as a string like "30s"
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+// loadConfig reads the TOML file filename and sets the flags of fs that
+// weren't given on the command line to its values. Unknown keys are
+// ignored with a warning.
+func loadConfig(fs *flag.FlagSet, filename string) error {
+	var cfg config
+	meta, err := toml.DecodeFile(filename, &cfg)
+	if err != nil {
+		return err
+	}
+	for _, key := range meta.Undecoded() {
+		warnf("%s: unknown option %s", filename, key)
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	v := reflect.ValueOf(cfg)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("toml")
+		if !meta.IsDefined(name) || set[name] {
+			continue
+		}
+		f := fs.Lookup(name)
+		var values []string
+		switch value := v.Field(i).Interface().(type) {
+		case []string:
+			values = value
+			// only repeatable flags take each value separately
+			if _, ok := f.Value.(*stringList); !ok {
+				values = []string{strings.Join(value, ",")}
+			}
+		default:
+			values = []string{fmt.Sprint(value)}
+		}
+		for _, s := range values {
+			if err := f.Value.Set(s); err != nil {
+				return fmt.Errorf("%s: invalid value for %s: %s", filename, name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// change describes a single change made to a feed
+type change struct {
+	title string
+	url   string
+	// detail is the reason for a removal, or the new value of a
+	// rewritten url or filled in title
+	detail string
+}
+
+// changes collects the differences between the input and the output
+type changes struct {
+	removed   []change
+	rewritten []change
+	titled    []change
+}
+
+// writeDiff writes a readable report of the changes to w, grouped by the
+// type of change
+func writeDiff(w io.Writer, c *changes) error {
+	sections := []struct {
+		name    string
+		changes []change
+		sep     string
+	}{
+		{"Removed feeds", c.removed, ": "},
+		{"Rewritten urls", c.rewritten, " -> "},
+		{"Filled in titles", c.titled, ": "},
+	}
+	for _, s := range sections {
+		if _, err := fmt.Fprintf(w, "%s (%d)\n", s.name, len(s.changes)); err != nil {
+			return err
+		}
+		for _, ch := range s.changes {
+			line := "<" + ch.url + ">" + s.sep + ch.detail
+			if ch.title != "" {
+				line = ch.title + " " + line
+			}
+			if _, err := fmt.Fprintf(w, "  %s\n", line); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDiffFile writes the report of the changes to filename, or to
+// stderr if filename is empty
+func writeDiffFile(filename string, c *changes) error {
+	if filename == "" {
+		return writeDiff(os.Stderr, c)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := writeDiff(f, c); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
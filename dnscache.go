@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// dnsCache caches the addresses of hosts for ttl so that repeated
+// connections to the same host resolve only once. It is safe for
+// concurrent use.
+type dnsCache struct {
+	ttl      time.Duration
+	resolver *net.Resolver
+	mu       sync.Mutex
+	entries  map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+func newDNSCache(ttl time.Duration, resolver *net.Resolver) *dnsCache {
+	return &dnsCache{
+		ttl:      ttl,
+		resolver: resolver,
+		entries:  map[string]dnsEntry{},
+	}
+}
+
+// lookup returns the addresses of host on network ("ip", "ip4" or
+// "ip6"), resolving it if it is not cached or the entry has expired.
+// Failed lookups are not cached.
+func (c *dnsCache) lookup(ctx context.Context, network, host string) ([]string, error) {
+	key := network + " " + host
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.addrs, nil
+	}
+
+	ips, err := c.resolver.LookupIP(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = ip.String()
+	}
+	debugf("resolved %s: %v", host, addrs)
+
+	c.mu.Lock()
+	c.entries[key] = dnsEntry{addrs: addrs, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+// dialContext returns a DialContext function for a transport that
+// resolves hosts with c and tries the addresses in order
+func (c *dnsCache) dialContext(dialer *net.Dialer, network string) func(ctx context.Context, _, addr string) (net.Conn, error) {
+	ipNetwork := "ip"
+	switch network {
+	case "tcp4":
+		ipNetwork = "ip4"
+	case "tcp6":
+		ipNetwork = "ip6"
+	}
+	return func(ctx context.Context, _, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		addrs, err := c.lookup(ctx, ipNetwork, host)
+		if err != nil {
+			return nil, err
+		}
+		var conn net.Conn
+		for _, a := range addrs {
+			conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(a, port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
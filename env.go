@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envPrefix is the prefix of the environment variables that set flags
+const envPrefix = "OPML_"
+
+// envName returns the environment variable for the flag with the given
+// name, e.g. OPML_USER_AGENT for -user-agent
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// loadEnv sets the flags that weren't given on the command line from
+// their environment variables. Repeatable flags take one value per line.
+// The flags are marked as set, so the -config file doesn't override them.
+// -version is left out since OPML_VERSION is a likely name for something
+// else.
+func loadEnv(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] || f.Name == "version" {
+			return
+		}
+		s, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		values := []string{s}
+		if _, ok := f.Value.(*stringList); ok {
+			values = strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == '\r' })
+		}
+		for _, v := range values {
+			if serr := fs.Set(f.Name, v); serr != nil {
+				err = fmt.Errorf("%s: invalid value for -%s: %s", envName(f.Name), f.Name, serr)
+				return
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/arthurk/feed/cleanup"
+)
+
+// badURLs are the kinds of broken feed urls in generated documents
+var badURLs = []string{
+	"https://feed-%d.invalid/rss.xml", // unknown host
+	"http://127.0.0.1:1/feed-%d.xml",  // connection refused
+	"ftp://example.com/feed-%d.xml",   // unsupported scheme
+}
+
+// generateMode reports whether args contain the -generate flag in any of
+// the forms the flag package accepts, e.g. -generate=10 or --generate 10
+func generateMode(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if i := strings.Index(name, "="); i >= 0 {
+			name = name[:i]
+		}
+		if name == "generate" {
+			return true
+		}
+	}
+	return false
+}
+
+// runGenerate writes an OPML document with synthetic feeds to stdout for
+// demos and benchmarks. It is started with -generate N and isn't listed
+// in the usage of the other flags.
+func runGenerate(args []string) {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	n := fs.Int("generate", 100, "number of feeds to generate")
+	badRatio := fs.Float64("bad-ratio", 0.2, "share of the feeds with broken urls, between 0 and 1")
+	goodURL := fs.String("good-url", "https://example.com/feeds/%d.xml", "url of the working feeds, %d is replaced with the number of the feed")
+	fs.Parse(args)
+	if *n < 0 {
+		log.Fatalf("-generate must not be negative")
+	}
+	if *badRatio < 0 || *badRatio > 1 {
+		log.Fatalf("-bad-ratio must be between 0 and 1")
+	}
+
+	feeds := []cleanup.Outline{}
+	bad := 0
+	for i := 0; i < *n; i++ {
+		// spread the broken feeds evenly
+		url := fmt.Sprintf(*goodURL, i)
+		if int(float64(i+1)**badRatio) > bad {
+			url = fmt.Sprintf(badURLs[bad%len(badURLs)], i)
+			bad++
+		}
+		title := fmt.Sprintf("Feed %d", i)
+		feeds = append(feeds, cleanup.Outline{Text: title, Title: title, Type: "rss", XmlURL: url})
+	}
+	doc := cleanup.CreateOpml("", cleanup.Head{Title: "generated feeds"}, feeds)
+	ow := opmlWriter{format: opmlFormat{indent: "  ", encoding: "UTF-8"}}
+	if err := ow.Write(os.Stdout, Result{Opml: doc}); err != nil {
+		log.Fatal(err)
+	}
+}
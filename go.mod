@@ -1,5 +1,9 @@
 module github.com/arthurk/feed
 
-go 1.15
+go 1.16
 
-require github.com/mmcdole/gofeed v1.1.0
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/mmcdole/gofeed v1.1.0
+	golang.org/x/net v0.0.0-20200301022130-244492dfa37a
+)
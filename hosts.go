@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// hostSet is a set of hostnames. A host matches if it or one of its
+// parent domains is in the set.
+type hostSet map[string]bool
+
+// loadHostSet reads a hostSet from s, which is either the name of a file
+// with one host per line or a comma-separated list of hosts. Empty lines
+// and lines starting with # are ignored in files.
+func loadHostSet(s string) (hostSet, error) {
+	set := hostSet{}
+	f, err := os.Open(s)
+	if os.IsNotExist(err) {
+		for _, host := range strings.Split(s, ",") {
+			set.add(host)
+		}
+		return set, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set.add(line)
+	}
+	return set, scanner.Err()
+}
+
+func (s hostSet) add(host string) {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if host != "" {
+		s[host] = true
+	}
+}
+
+// matches reports whether the host of the feed url raw is in s
+func (s hostSet) matches(raw string) bool {
+	host := strings.ToLower(urlHost(raw))
+	for host != "" {
+		if s[host] {
+			return true
+		}
+		i := strings.Index(host, ".")
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/arthurk/feed/cleanup"
+)
+
+// inputFormats maps the names of the input formats to their decoders
+var inputFormats = map[string]func(io.Reader) (cleanup.Opml, error){
+	"opml": cleanup.ReadOpml,
+	"json": cleanup.ReadJSON,
+}
+
+// readOpmlFile reads the file at filename in the given input format.
+// filename can also be "-" for stdin or a http or https url, which is
+// fetched with the client, headers and credentials of c.
+func readOpmlFile(c *cleanup.Checker, filename, format string) cleanup.Opml {
+	var r io.Reader = os.Stdin
+	if filename == "-" {
+		infof("reading stdin")
+	} else if strings.HasPrefix(filename, "http://") || strings.HasPrefix(filename, "https://") {
+		infof("fetching %s", cleanup.RedactURL(filename))
+		req, err := c.NewRequest(context.Background(), http.MethodGet, filename)
+		if err != nil {
+			log.Fatalf("fetching %s: %s", cleanup.RedactURL(filename), err)
+		}
+		resp, err := c.Client.Do(req)
+		if err != nil {
+			var uerr *url.Error
+			if errors.As(err, &uerr) {
+				err = uerr.Err
+			}
+			log.Fatalf("fetching %s: %s", cleanup.RedactURL(filename), err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("fetching %s: %s", cleanup.RedactURL(filename), resp.Status)
+		}
+		r = resp.Body
+		filename = cleanup.RedactURL(filename)
+	} else {
+		infof("reading %s", filename)
+		f, err := os.Open(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		r = f
+	}
+	opml, err := inputFormats[format](r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s is not a valid %s file: %s\n", filename, strings.ToUpper(format), err)
+		os.Exit(exitFatal)
+	}
+	return opml
+}
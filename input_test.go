@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arthurk/feed/cleanup"
+)
+
+func TestReadOpmlFileRemote(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "jane" || pass != "secret" || r.Header.Get("X-Token") != "abc" || r.Header.Get("User-Agent") != "reader/2.0" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`<opml version="2.0"><head><title>remote</title></head><body><outline text="Blog" xmlUrl="https://example.com/feed"/></body></opml>`))
+	}))
+	defer srv.Close()
+
+	cleanup.SetLogLevel(cleanup.LevelQuiet)
+	defer cleanup.SetLogLevel(cleanup.LevelInfo)
+	c := &cleanup.Checker{
+		Client:    srv.Client(),
+		UserAgent: "reader/2.0",
+		Header:    http.Header{"X-Token": {"abc"}},
+		BasicAuth: "jane:secret",
+	}
+	opml := readOpmlFile(c, srv.URL+"/feeds.opml", "opml")
+	if opml.Head.Title != "remote" || len(opml.Body.Outline) != 1 {
+		t.Errorf("got %+v", opml)
+	}
+}
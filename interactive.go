@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/arthurk/feed/cleanup"
+)
+
+// confirmRemovals asks on out whether each of the failed feeds should be
+// removed, reading the answers from in, and returns the indexes of the
+// feeds to keep. An empty answer removes the feed, and so does the end of
+// the input for all remaining feeds.
+func confirmRemovals(in io.Reader, out io.Writer, failed []cleanup.FeedResult) map[int]bool {
+	keep := map[int]bool{}
+	scanner := bufio.NewScanner(in)
+	for i, r := range failed {
+		for {
+			fmt.Fprintf(out, "[%d/%d] %s %s\n  %s\nremove? [Y/n] ", i+1, len(failed), r.Entry.Title, cleanup.RedactURL(r.Entry.XmlURL), r.Err)
+			if !scanner.Scan() {
+				fmt.Fprintln(out)
+				return keep
+			}
+			answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+			if answer == "" || answer == "y" || answer == "yes" {
+				break
+			}
+			if answer == "n" || answer == "no" {
+				keep[r.Index] = true
+				break
+			}
+		}
+	}
+	return keep
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log"
+
+	"github.com/arthurk/feed/cleanup"
+)
+
+// The levels are shared with the cleanup package so -log-level applies
+// to the messages of both. Fatal errors are always logged using
+// log.Fatal.
+
+// debugf logs details like HTTP requests and responses
+func debugf(format string, args ...interface{}) {
+	cleanup.Logf(cleanup.LevelDebug, format, args...)
+}
+
+// infof logs progress messages
+func infof(format string, args ...interface{}) {
+	cleanup.Logf(cleanup.LevelInfo, format, args...)
+}
+
+// warnf logs problems with single feeds
+func warnf(format string, args ...interface{}) {
+	cleanup.Logf(cleanup.LevelWarn, format, args...)
+}
+
+// summaryf logs the results of the run. These are logged at every level.
+func summaryf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
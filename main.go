@@ -5,144 +5,935 @@
 package main
 
 import (
-	"encoding/xml"
+	"context"
+	"flag"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
-	"net/http"
+	"mime"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/mmcdole/gofeed"
+	"github.com/arthurk/feed/cleanup"
 )
 
-type Outline struct {
-	XMLName     xml.Name `xml:"outline"`
-	Text        string   `xml:"text,attr"`
-	Title       string   `xml:"title,attr"`
-	Description string   `xml:"description,attr"`
-	Type        string   `xml:"type,attr"`
-	Version     string   `xml:"version,attr"`
-	HtmlURL     string   `xml:"htmlUrl,attr"`
-	XmlURL      string   `xml:"xmlUrl,attr"`
+// Exit codes of the program. Fatal errors like an unreadable input file
+// exit through log.Fatal, which uses exitFatal.
+const (
+	exitOK            = 0
+	exitFatal         = 1
+	exitFailedFeeds   = 2
+	exitTooManyFailed = 3
+	exitInterrupted   = 4
+)
+
+// stringList is a flag that can be given multiple times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// concurrencyFlag is the -concurrency flag, a number of workers or "auto",
+// which is stored as 0
+type concurrencyFlag int
+
+func (c concurrencyFlag) String() string {
+	if c == 0 {
+		return "auto"
+	}
+	return strconv.Itoa(int(c))
+}
+
+func (c *concurrencyFlag) Set(s string) error {
+	if s == "auto" {
+		*c = 0
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return fmt.Errorf("must be auto or a number of at least 1")
+	}
+	*c = concurrencyFlag(n)
+	return nil
 }
 
-type Head struct {
-	XMLName     xml.Name `xml:"head"`
-	Title       string   `xml:"title"`
-	DateCreated string   `xml:"dateCreated"`
+// UnmarshalTOML allows both numbers and "auto" in the config file
+func (c *concurrencyFlag) UnmarshalTOML(v interface{}) error {
+	return c.Set(fmt.Sprint(v))
 }
 
-type Body struct {
-	XMLName xml.Name  `xml:"body"`
-	Outline []Outline `xml:"outline"`
+// thresholdFlag is the -fail-threshold flag, a fraction given as a
+// percentage like "50%" or a number like 0.5. 0 disables it.
+type thresholdFlag float64
+
+func (t thresholdFlag) String() string {
+	return strconv.FormatFloat(float64(t)*100, 'f', -1, 64) + "%"
 }
 
-type Opml struct {
-	XMLName xml.Name `xml:"opml"`
-	Version string   `xml:"version,attr"`
-	Head    Head
-	Body    Body
+func (t *thresholdFlag) Set(s string) error {
+	s = strings.TrimSpace(s)
+	percent := strings.HasSuffix(s, "%")
+	f, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err == nil && percent {
+		f /= 100
+	}
+	if err != nil || f < 0 || f > 1 {
+		return fmt.Errorf("must be a percentage like 50%% or a fraction between 0 and 1")
+	}
+	*t = thresholdFlag(f)
+	return nil
 }
 
-func parseFeed(url string, r io.Reader) (*gofeed.Feed, error) {
-	fp := gofeed.NewParser()
-	feed, err := fp.Parse(r)
+// UnmarshalTOML allows both numbers and percentages in the config file
+func (t *thresholdFlag) UnmarshalTOML(v interface{}) error {
+	return t.Set(fmt.Sprint(v))
+}
+
+// autoConcurrency returns the number of workers for -concurrency auto.
+// The checks mostly wait for the network, so it uses more workers than
+// CPUs, but not more than there are feeds.
+func autoConcurrency(feeds int) int {
+	n := 4 * runtime.NumCPU()
+	if n > 50 {
+		n = 50
+	}
+	if n > feeds {
+		n = feeds
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// stdinIsPipe reports whether stdin is connected to a pipe or file
+// rather than a terminal
+func stdinIsPipe() bool {
+	fi, err := os.Stdin.Stat()
 	if err != nil {
-		return nil, err
+		return false
 	}
-	return feed, nil
+	return fi.Mode()&os.ModeCharDevice == 0
 }
 
-// getFeed fetches the feed, parses it and returns a Feed
-func getFeed(url string) (*gofeed.Feed, error) {
-	// fetch xml from remote
-	resp, err := http.Get(url)
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
 	if err != nil {
-		return nil, err
+		return false
 	}
-	defer resp.Body.Close()
+	return fi.Mode()&os.ModeCharDevice != 0
+}
 
-	// if status is not 200 the feed doesn't exist
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("\"%s\": status %d", url, resp.StatusCode)
+// parseAge parses a duration like time.ParseDuration, additionally
+// accepting a number of days like "365d"
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func main() {
+	if generateMode(os.Args[1:]) {
+		runGenerate(os.Args[1:])
+		return
+	}
+
+	start := time.Now()
+	var inputs stringList
+	flag.Var(&inputs, "input", "OPML file or http(s) url to read, or - for stdin (can be repeated, default rss-export.opml)")
+	inputFormat := flag.String("input-format", "opml", "format of the input files: opml or json (an array of objects with title, xmlUrl and htmlUrl)")
+	title := flag.String("title", "", "title of the output OPML (default the title of the first input)")
+	ownerName := flag.String("owner-name", "", "owner name of the output OPML (default the owner of the first input)")
+	ownerEmail := flag.String("owner-email", "", "owner email of the output OPML (default the owner of the first input)")
+	outputFile := flag.String("output", "", "file to write the cleaned OPML to (default stdout)")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout for each feed request, including reading the body")
+	connectTimeout := flag.Duration("connect-timeout", 30*time.Second, "timeout for connecting to a host")
+	responseHeaderTimeout := flag.Duration("response-header-timeout", 0, "timeout for receiving the response headers after sending a request (0 for none)")
+	proxy := flag.String("proxy", "", "HTTP or SOCKS5 proxy url, overrides HTTP_PROXY and HTTPS_PROXY (the -timeout includes connecting to the proxy)")
+	perHostDelay := flag.Duration("per-host-delay", 0, "minimum time between requests to the same host")
+	jitter := flag.Duration("jitter", 0, "delay the check of each feed by a random duration up to this, to spread out the load")
+	shuffle := flag.Bool("shuffle", false, "check the feeds in a random order, the output keeps the order of the input")
+	seed := flag.Int64("seed", 0, "seed for -jitter and -shuffle, runs with the same seed use the same delays and order (0 for a random seed)")
+	insecure := flag.Bool("insecure", false, "don't verify TLS certificates")
+	minTLS := flag.String("min-tls", "", "minimum TLS version: 1.0, 1.1, 1.2 or 1.3")
+	dnsCacheTTL := flag.Duration("dns-cache", 0, "cache DNS lookups for this long, e.g. 1m (0 disables the cache)")
+	resolver := flag.String("resolver", "", "ip:port of a DNS server to use instead of the system resolver, e.g. 1.1.1.1:53")
+	ipVersion := flag.String("ip-version", "auto", "IP version used to connect: auto, 4 or 6")
+	maxIdleConns := flag.Int("max-idle-conns", 100, "maximum number of idle connections kept for reuse")
+	maxIdleConnsPerHost := flag.Int("max-idle-conns-per-host", 10, "maximum number of idle connections kept for reuse per host")
+	idleConnTimeout := flag.Duration("idle-conn-timeout", 90*time.Second, "how long idle connections are kept for reuse")
+	maxBody := flag.Int64("max-body", 10<<20, "maximum size of a feed in bytes, larger feeds fail (0 for no limit)")
+	var headers stringList
+	flag.Var(&headers, "header", "extra header sent with every request, as \"Name: Value\" (can be repeated)")
+	basicAuth := flag.String("basic-auth", "", "credentials sent with every request, as user:pass")
+	limit := flag.Int("limit", 0, "only check the first N feeds, after removing duplicates (0 for no limit)")
+	maxRedirects := flag.Int("max-redirects", 10, "maximum number of redirects followed for a feed, feeds with more fail")
+	concurrency := concurrencyFlag(10)
+	flag.Var(&concurrency, "concurrency", "number of feeds to check in parallel, or auto to choose it from the number of CPUs and feeds")
+	retries := flag.Int("retries", 2, "number of times to retry a feed on connection errors and responses with a -retry-status")
+	retryStatus := flag.String("retry-status", "500-599", "comma-separated HTTP status codes and ranges that are retried, e.g. 429,503")
+	maxRetryAfter := flag.Duration("max-retry-after", time.Minute, "maximum time to wait before a retry when the response has a Retry-After header")
+	userAgent := flag.String("user-agent", cleanup.DefaultUserAgent, "User-Agent header sent with each request")
+	accept := flag.String("accept", cleanup.DefaultAccept, "Accept header sent with each request")
+	strict := flag.Bool("strict", false, "fail responses that are html pages or feeds without a type or title")
+	feedContentTypes := flag.String("feed-content-types", "", "comma-separated content types that count as a feed with -strict, in addition to "+strings.Join(cleanup.DefaultFeedContentTypes, ", "))
+	minItems := flag.Int("min-items", 0, "fail feeds with fewer items than this")
+	autodiscover := flag.Bool("autodiscover", false, "use the feed linked from html pages returned for a feed url")
+	detectParked := flag.Bool("detect-parked", false, "fail feeds whose response looks like a parked or for sale domain")
+	okStatus := flag.String("ok-status", "200-299", "comma-separated HTTP status codes and ranges that count as success")
+	method := flag.String("method", "get", "how to check feeds: head, get or auto (head with get fallback)")
+	maxAge := flag.String("max-age", "", "flag feeds whose newest item is older than this, e.g. 365d")
+	slowThreshold := flag.Duration("slow-threshold", 0, "list feeds that took longer than this to fetch in the summary")
+	checkEnclosure := flag.Bool("check-enclosure", false, "report feeds whose newest enclosure responds with 404 or 410")
+	checkHTMLURL := flag.Bool("check-htmlurl", false, "also check the site url of each feed and report dead site links")
+	requireHTMLURL := flag.Bool("require-htmlurl", false, "fail feeds whose site url is dead (implies -check-htmlurl)")
+	removeStale := flag.Bool("remove-stale", false, "remove stale feeds from the output")
+	report := flag.String("report", "", "write a report of all checked feeds in this format (json or html)")
+	reportFile := flag.String("report-file", "", "file to write the report to (default stderr)")
+	failOnError := flag.Bool("fail-on-error", false, fmt.Sprintf("exit with status %d if any feed failed", exitFailedFeeds))
+	var failThreshold thresholdFlag
+	flag.Var(&failThreshold, "fail-threshold", fmt.Sprintf("don't write any output and exit with status %d if more than this share of the checked feeds failed, e.g. 50%% (0 to disable)", exitTooManyFailed))
+	dryRun := flag.Bool("dry-run", false, fmt.Sprintf("only report which feeds would be removed and write the -diff, -csv-file and -removed-output reports, but not the OPML (exits with status %d if any feed failed)", exitFailedFeeds))
+	cacheFile := flag.String("cache", "", "file to cache ETag and Last-Modified headers in for conditional requests")
+	stateFile := flag.String("state", "", "file to record the result of each feed in, to resume interrupted runs")
+	recheckAfter := flag.Duration("recheck-after", 24*time.Hour, "with -state, reuse the results of feeds checked more recently than this")
+	deadline := flag.Duration("deadline", 0, "maximum duration of the whole run, feeds not checked in time are kept")
+	interactive := flag.Bool("interactive", false, "ask before removing each failed feed (only if stdin is a terminal)")
+	keepFailed := flag.Bool("keep-failed", false, "keep failed feeds in the output and mark them with a status attribute")
+	fillTitles := flag.Bool("fill-titles", false, "set missing titles of kept feeds from the feed")
+	normalizeType := flag.Bool("normalize-type", false, "set the type of kept feeds to rss or atom from the feed")
+	syncTitleText := flag.Bool("sync-title-text", false, "set the title or text of kept feeds from the other one if it is empty")
+	allowHosts := flag.String("allow-hosts", "", "file or comma-separated list of hosts whose feeds are kept even if the check fails")
+	denyHosts := flag.String("deny-hosts", "", "file or comma-separated list of hosts whose feeds are removed without checking them")
+	useAlternates := flag.Bool("use-alternates", false, "try the mirror urls in the x-alt-url attribute of failed feeds and rewrite the url to the first that works")
+	preferHTTPS := flag.Bool("prefer-https", false, "try https first for http feeds and rewrite the url if it works")
+	dedupe := flag.Bool("dedupe", false, "remove duplicate feeds before checking")
+	dedupeByContent := flag.Bool("dedupe-by-content", false, "remove feeds that serve the same items as another feed, keeping the cleanest url")
+	showDiff := flag.Bool("diff", false, "write a report of all removed feeds, rewritten urls and filled in titles")
+	diffFile := flag.String("diff-file", "", "file to write the -diff report to (default stderr)")
+	listFailed := flag.Bool("list-failed", false, "only print the title, url and error of each failed feed to stdout, separated by tabs, and don't write the OPML")
+	summaryJSON := flag.Bool("summary-json", false, "print a summary of the run as JSON to stdout (requires -output)")
+	webhook := flag.String("webhook", "", "url to post the summary of the run to as JSON, like -summary-json")
+	metricsFile := flag.String("metrics-file", "", "file to write metrics of the run to in the Prometheus text format")
+	csvFile := flag.String("csv-file", "", "file to write a CSV of all checked feeds to")
+	removedOutput := flag.String("removed-output", "", "file to write an OPML of the removed feeds to")
+	recheckFailed := flag.String("recheck-failed", "", "check the feeds of a -removed-output file again, write the recovered feeds to -output and keep the others in the file")
+	outputFormat := flag.String("format", "opml", "format of the output: opml, json, html or csv")
+	indent := flag.String("indent", "2", "indentation of the output, a number of spaces, tab, or a string")
+	compact := flag.Bool("compact", false, "write the output without indentation")
+	xmlEncoding := flag.String("xml-encoding", "UTF-8", "spelling of the encoding attribute of the XML declaration, UTF-8 or utf-8 (the output is always UTF-8)")
+	noXMLHeader := flag.Bool("no-xml-header", false, "write the OPML without the XML declaration")
+	stripQuery := flag.Bool("strip-query", false, "remove the query from the urls of kept feeds if the feed is the same without it")
+	normalizeURLs := flag.Bool("normalize-urls", false, "rewrite the feed and html urls of kept feeds to a canonical form")
+	sortBy := flag.String("sort", "none", "sort the output feeds by title, url or none")
+	pruneEmpty := flag.Bool("prune-empty", false, "remove categories whose feeds were all removed")
+	quietSuccess := flag.Bool("quiet-success", false, "don't log a line for every feed, only failures and the summary")
+	showProgress := flag.Bool("progress", false, "show the progress of the checks on stderr")
+	traceFile := flag.String("trace-file", "", "file to write the headers and timings of every HTTP request to as JSON lines")
+	configFile := flag.String("config", "", "TOML file with defaults for the other flags")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	noColor := flag.Bool("no-color", false, "don't color the log output (also disabled by NO_COLOR or when stderr isn't a terminal)")
+	logLevelName := flag.String("log-level", "info", "log verbosity: debug, info, warn, error or quiet")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(versionString())
+		return
+	}
+
+	if err := loadEnv(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	if *configFile != "" {
+		if err := loadConfig(flag.CommandLine, *configFile); err != nil {
+			log.Fatalf("-config: %s", err)
+		}
 	}
 
-	// parse feed to check if it's valid
-	feed, err := parseFeed(url, resp.Body)
+	level, err := cleanup.ParseLogLevel(*logLevelName)
 	if err != nil {
-		return nil, err
+		log.Fatalf("-log-level: %s", err)
 	}
+	cleanup.SetLogLevel(level)
+	cleanup.SetColor(!*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stderr))
 
-	return feed, nil
-}
+	if *maxRedirects < 1 {
+		log.Fatalf("-max-redirects must be at least 1")
+	}
+	if *limit < 0 {
+		log.Fatalf("-limit must not be negative")
+	}
+	if *retries < 0 {
+		log.Fatalf("-retries must not be negative")
+	}
+	if *method != "head" && *method != "get" && *method != "auto" {
+		log.Fatalf("-method must be head, get or auto")
+	}
+	okRanges, err := cleanup.ParseStatusRanges(*okStatus)
+	if err != nil {
+		log.Fatalf("-ok-status: %s", err)
+	}
+	retryRanges, err := cleanup.ParseStatusRanges(*retryStatus)
+	if err != nil {
+		log.Fatalf("-retry-status: %s", err)
+	}
+	contentTypes := append([]string{}, cleanup.DefaultFeedContentTypes...)
+	for _, t := range strings.Split(*feedContentTypes, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if _, _, err := mime.ParseMediaType(t); err != nil || strings.Contains(t, ";") {
+			log.Fatalf("-feed-content-types: invalid content type %q", t)
+		}
+		contentTypes = append(contentTypes, t)
+	}
+	if *maxRetryAfter <= 0 {
+		log.Fatalf("-max-retry-after must be positive")
+	}
+	var staleAge time.Duration
+	if *maxAge != "" {
+		staleAge, err = parseAge(*maxAge)
+		if err != nil {
+			log.Fatalf("-max-age: %s", err)
+		}
+	}
+	if *sortBy != "none" && *sortBy != "title" && *sortBy != "url" {
+		log.Fatalf("-sort must be title, url or none")
+	}
+	if *report != "" && *report != "json" && *report != "html" {
+		log.Fatalf("-report must be json or html")
+	}
+	if *summaryJSON && *outputFile == "" && !*dryRun {
+		log.Fatalf("-summary-json prints to stdout, use -output to write the OPML to a file")
+	}
+	if *listFailed && (*outputFile != "" || *removedOutput != "" || *summaryJSON || *showDiff || *csvFile != "") {
+		log.Fatalf("-list-failed prints to stdout instead of writing the OPML, it can't be used with -output, -removed-output, -diff, -csv-file or -summary-json")
+	}
+	if _, ok := inputFormats[*inputFormat]; !ok {
+		log.Fatalf("-input-format must be opml or json")
+	}
+	if *recheckFailed != "" {
+		// the removed file is both the input and the removed output, so
+		// every feed that isn't recovered stays in it
+		if len(inputs) > 0 || flag.NArg() > 0 || *removedOutput != "" {
+			log.Fatalf("-recheck-failed can't be used with -input or -removed-output")
+		}
+		if *keepFailed || *limit > 0 {
+			log.Fatalf("-recheck-failed can't be used with -keep-failed or -limit")
+		}
+		if *inputFormat != "opml" {
+			log.Fatalf("-recheck-failed reads an OPML file, it can't be used with -input-format")
+		}
+		if strings.Contains(*recheckFailed, "://") {
+			log.Fatalf("-recheck-failed must be a local file, it is rewritten with the feeds that still fail")
+		}
+		inputs = stringList{*recheckFailed}
+		*removedOutput = *recheckFailed
+	}
+
+	// the output isn't transcoded, so any other encoding would be wrong
+	if !strings.EqualFold(*xmlEncoding, "UTF-8") && !strings.EqualFold(*xmlEncoding, "UTF8") {
+		log.Fatalf("-xml-encoding: the output is written as UTF-8, got %q", *xmlEncoding)
+	}
+	format := opmlFormat{indent: parseIndent(*indent), encoding: *xmlEncoding, noHeader: *noXMLHeader}
+	if *compact {
+		format.indent = ""
+	}
+	ow, err := newOutputWriter(*outputFormat, format)
+	if err != nil {
+		log.Fatalf("-format: %s", err)
+	}
+
+	var minTLSVersion uint16
+	if *minTLS != "" {
+		minTLSVersion, err = parseTLSVersion(*minTLS)
+		if err != nil {
+			log.Fatalf("-min-tls: %s", err)
+		}
+	}
+	network, err := parseIPVersion(*ipVersion)
+	if err != nil {
+		log.Fatalf("-ip-version: %s", err)
+	}
+	if *insecure {
+		warnf("WARNING: TLS certificates are not verified, connections are not secure")
+	}
+	client, err := newClient(clientConfig{
+		timeout:               *timeout,
+		connectTimeout:        *connectTimeout,
+		responseHeaderTimeout: *responseHeaderTimeout,
 
-// readOpml reads an OPML file and returns a Opml struct
-func readOpml(filename string) Opml {
-	log.Printf("reading %s", filename)
+		proxy:    *proxy,
+		insecure: *insecure,
+		minTLS:   minTLSVersion,
 
-	data, err := ioutil.ReadFile(filename)
+		maxIdleConns:        *maxIdleConns,
+		maxIdleConnsPerHost: *maxIdleConnsPerHost,
+		idleConnTimeout:     *idleConnTimeout,
+
+		network:     network,
+		dnsCacheTTL: *dnsCacheTTL,
+		resolver:    *resolver,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
-	opml := Opml{}
-	err = xml.Unmarshal(data, &opml)
+	if *traceFile != "" {
+		tt, err := newTraceTransport(client.Transport, *traceFile)
+		if err != nil {
+			log.Fatalf("-trace-file: %s", err)
+		}
+		client.Transport = tt
+	}
+
+	c := &cleanup.Checker{
+		Client:       client,
+		Concurrency:  int(concurrency),
+		MaxRedirects: *maxRedirects,
+		Method:       *method,
+		Retries:      *retries,
+		RetryStatus:  retryRanges,
+		UserAgent:    *userAgent,
+		Accept:       *accept,
+		OKStatus:     okRanges,
+		MaxAge:       staleAge,
+		Strict:       *strict,
+		MinItems:     *minItems,
+		MaxBody:      *maxBody,
+		PerHostDelay: *perHostDelay,
+		Jitter:       *jitter,
+		Seed:         *seed,
+		Shuffle:      *shuffle,
+		DetectParked: *detectParked,
+		Autodiscover: *autodiscover,
+		PreferHTTPS:  *preferHTTPS,
+
+		MaxRetryAfter:    *maxRetryAfter,
+		FeedContentTypes: contentTypes,
+		UseAlternates:    *useAlternates,
+		StripQuery:       *stripQuery,
+		CheckEnclosure:   *checkEnclosure,
+		CheckHTMLURL:     *checkHTMLURL,
+		RequireHTMLURL:   *requireHTMLURL,
+		QuietSuccess:     *quietSuccess,
+	}
+	c.Header, err = parseHeaders(headers)
 	if err != nil {
+		log.Fatalf("-header: %s", err)
+	}
+	if *basicAuth != "" {
+		if !strings.Contains(*basicAuth, ":") {
+			log.Fatalf("-basic-auth must be user:pass")
+		}
+		c.BasicAuth = *basicAuth
+	}
+	// input files can also be given as arguments. Read from stdin when
+	// data is piped in and no input file was given.
+	inputs = append(inputs, flag.Args()...)
+	if len(inputs) == 0 {
+		if stdinIsPipe() {
+			inputs = stringList{"-"}
+		} else {
+			inputs = stringList{"rss-export.opml"}
+		}
+	}
+
+	// merge all inputs into the first one
+	opml := readOpmlFile(c, inputs[0], *inputFormat)
+	for _, filename := range inputs[1:] {
+		other := readOpmlFile(c, filename, *inputFormat)
+		opml.Body.Outline = append(opml.Body.Outline, other.Body.Outline...)
+		opml.Extra = append(opml.Extra, other.Extra...)
+	}
+	if *title != "" {
+		opml.Head.Title = *title
+	}
+	if *ownerName != "" {
+		opml.Head.OwnerName = *ownerName
+	}
+	if *ownerEmail != "" {
+		opml.Head.OwnerEmail = *ownerEmail
+	}
+	infof("found %d entries", len(opml.Body.Outline))
+
+	if *cacheFile != "" {
+		c.Cache = loadCache(*cacheFile)
+	}
+	var state runState
+	if *stateFile != "" {
+		state = loadState(*stateFile)
+		c.Previous = state.previous(*recheckAfter)
+	}
+	var allowed, denied hostSet
+	if *allowHosts != "" {
+		if allowed, err = loadHostSet(*allowHosts); err != nil {
+			log.Fatalf("-allow-hosts: %s", err)
+		}
+	}
+	if *denyHosts != "" {
+		if denied, err = loadHostSet(*denyHosts); err != nil {
+			log.Fatalf("-deny-hosts: %s", err)
+		}
+	}
+
+	// merged files often contain the same feeds
+	diff := &changes{}
+	if *dedupe || len(inputs) > 1 {
+		var duplicates []cleanup.Outline
+		opml.Body.Outline, duplicates = dedupeOutlines(opml.Body.Outline)
+		infof("removed %d duplicates", len(duplicates))
+		for _, o := range duplicates {
+			diff.removed = append(diff.removed, change{title: o.Title, url: o.XmlURL, detail: "duplicate"})
+		}
+	}
+
+	// feeds on denied hosts are removed without a request
+	removed := []cleanup.Outline{}
+	if denied != nil {
+		opml.Body.Outline = cleanup.FilterOutlines(opml.Body.Outline, false, func(i int, o *cleanup.Outline) bool {
+			if !denied.matches(o.XmlURL) {
+				return true
+			}
+			infof("denied host: %s", cleanup.RedactURL(o.XmlURL))
+			diff.removed = append(diff.removed, change{title: o.Title, url: o.XmlURL, detail: "denied host"})
+			removed = append(removed, *o)
+			return false
+		})
+	}
+
+	// drop everything after the first feeds when testing options
+	if *limit > 0 {
+		opml.Body.Outline = cleanup.FilterOutlines(opml.Body.Outline, true, func(i int, o *cleanup.Outline) bool {
+			return i < *limit
+		})
+		infof("checking the first %d feeds", cleanup.CountFeeds(opml.Body.Outline))
+	}
+
+	var bar *progress
+	if *showProgress {
+		bar = newProgress(os.Stderr, isTerminal(os.Stderr), cleanup.CountFeeds(opml.Body.Outline))
+		log.SetOutput(bar)
+		c.OnResult = func(r cleanup.FeedResult) {
+			bar.update(r.Err != nil)
+		}
+	}
+
+	// stop checking on ctrl-c but still write the output, keeping the
+	// feeds that weren't checked
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx := sigCtx
+	if *deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(sigCtx, *deadline)
+		defer cancel()
+	}
+	if concurrency == 0 {
+		c.Concurrency = autoConcurrency(cleanup.CountFeeds(opml.Body.Outline))
+		infof("checking %d feeds in parallel", c.Concurrency)
+	}
+	res, err := c.Check(ctx, opml)
+	if err != nil && ctx.Err() == nil {
 		log.Fatal(err)
 	}
-	return opml
-}
+	interrupted := sigCtx.Err() != nil
+	stop()
+	if bar != nil {
+		bar.finish()
+		log.SetOutput(os.Stderr)
+	}
+	if c.Cache != nil {
+		if err := saveCache(c.Cache, *cacheFile); err != nil {
+			warnf("writing cache: %s", err)
+		}
+	}
+	if state != nil {
+		reused := 0
+		for _, r := range res.All() {
+			if r.Reused {
+				reused++
+			}
+		}
+		infof("reused %d results from %s", reused, *stateFile)
+		state.update(res.All())
+		if err := state.save(*stateFile); err != nil {
+			warnf("writing state: %s", err)
+		}
+	}
+	if interrupted {
+		summaryf("%s", cleanup.Colorize(cleanup.Yellow, fmt.Sprintf("interrupted, %d feeds not checked", len(res.Skipped))))
+	} else if len(res.Skipped) > 0 {
+		summaryf("%s", cleanup.Colorize(cleanup.Yellow, fmt.Sprintf("deadline reached, %d feeds skipped", len(res.Skipped))))
+	}
+	failed := fmt.Sprintf("failed: %d", len(res.Failed))
+	if len(res.Failed) > 0 {
+		failed = cleanup.Colorize(cleanup.Red, failed)
+	}
+	summaryf("%s %s", cleanup.Colorize(cleanup.Green, fmt.Sprintf("success: %d", len(res.Kept))), failed)
+	// failed feeds on allowed hosts aren't removed
+	keptAllowed := 0
+	for _, r := range res.Failed {
+		if allowed.matches(r.Entry.XmlURL) {
+			keptAllowed++
+		}
+	}
+	if keptAllowed > 0 {
+		summaryf("kept (allowed host): %d", keptAllowed)
+	}
+	counts := countFailures(res.Failed)
+	summary := runSummary{
+		Feeds:   len(res.Kept) + len(res.Failed) + len(res.Skipped),
+		OK:      len(res.Kept),
+		Failed:  len(res.Failed),
+		Skipped: len(res.Skipped),
 
-func createOpml(feeds []Outline) Opml {
-	newOpml := Opml{
-		Version: "2.0",
-		Head: Head{
-			Title:       "feeds",
-			DateCreated: time.Now().Format(time.RFC822),
-		},
-		Body: Body{
-			Outline: feeds,
-		},
-	}
-	return newOpml
-}
+		KeptAllowed: keptAllowed,
+		Failures:    map[string]int{},
+		Reason:      "completed",
+	}
+	for category, n := range counts {
+		if n > 0 {
+			summary.Failures[category] = n
+		}
+	}
+	if interrupted {
+		summary.Reason = "interrupted"
+	} else if len(res.Skipped) > 0 {
+		summary.Reason = "deadline"
+	}
+	// finish prints the summary and exits with code if it isn't 0. An
+	// interrupted run exits with exitInterrupted unless nothing was
+	// written because of -fail-threshold.
+	finish := func(removed, code int) {
+		if interrupted && code != exitTooManyFailed {
+			code = exitInterrupted
+		}
+		switch code {
+		case exitFailedFeeds:
+			summary.Reason = "failed feeds"
+		case exitTooManyFailed:
+			summary.Reason = "fail threshold"
+		}
+		summary.Removed = removed
+		summary.ExitCode = code
+		summary.DurationMs = time.Since(start).Milliseconds()
+		if *summaryJSON {
+			if err := printSummary(summary); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *webhook != "" {
+			if err := postWebhook(client, *webhook, summary); err != nil {
+				warnf("webhook: %s", err)
+			}
+		}
+		if code != 0 {
+			os.Exit(code)
+		}
+	}
+	for _, category := range failCategories {
+		if counts[category] > 0 {
+			summaryf("  %-20s %d", category, counts[category])
+		}
+	}
+	if *metricsFile != "" {
+		if err := writeMetrics(*metricsFile, len(res.Kept), len(res.Failed), len(res.Skipped), counts, time.Since(start)); err != nil {
+			warnf("writing metrics: %s", err)
+		}
+	}
+	stale := 0
+	for _, r := range res.Kept {
+		if r.Stale {
+			warnf("%s", cleanup.Colorize(cleanup.Yellow, fmt.Sprintf("stale: %s (last updated %s)", cleanup.RedactURL(r.Entry.XmlURL), r.Updated.Format("2006-01-02"))))
+			stale++
+		}
+	}
+	summary.Stale = stale
+	if staleAge > 0 {
+		summaryf("%s", cleanup.Colorize(cleanup.Yellow, fmt.Sprintf("stale: %d", stale)))
+	}
+	if *checkEnclosure {
+		dead := 0
+		for _, r := range res.Kept {
+			if r.DeadEnclosure != "" {
+				warnf("dead enclosure: %s (%s)", cleanup.RedactURL(r.Entry.XmlURL), cleanup.RedactURL(r.DeadEnclosure))
+				dead++
+			}
+		}
+		summaryf("dead enclosures: %d", dead)
+	}
+	if *checkHTMLURL || *requireHTMLURL {
+		dead := 0
+		for _, r := range res.All() {
+			if r.HTMLErr != nil {
+				dead++
+			}
+		}
+		summaryf("dead site links: %d", dead)
+	}
+	if *slowThreshold > 0 {
+		slow := 0
+		for _, r := range res.All() {
+			if !r.Skipped && r.Duration > *slowThreshold {
+				warnf("slow: %s (%s)", cleanup.RedactURL(r.Entry.XmlURL), r.Duration.Round(time.Millisecond))
+				slow++
+			}
+		}
+		summaryf("slow: %d", slow)
+	}
+	if *stripQuery {
+		stripped := 0
+		for _, r := range res.Kept {
+			if r.Stripped != "" {
+				stripped++
+			}
+		}
+		summaryf("removed query: %d", stripped)
+	}
+	if *preferHTTPS {
+		upgraded := 0
+		for _, r := range res.Kept {
+			if r.Upgraded != "" {
+				upgraded++
+			}
+		}
+		summaryf("upgraded to https: %d", upgraded)
+	}
 
-func main() {
-	opml := readOpml("rss-export.opml")
-	log.Printf("found %d entries", len(opml.Body.Outline))
-
-	numFeeds := len(opml.Body.Outline)
-
-	successFeeds := []Outline{}
-	failedFeeds := []Outline{}
-	for i := 0; i < numFeeds; i++ {
-		// skip outline elements that are not feeds
-		entry := opml.Body.Outline[i]
-		log.Printf("[%d/%d] %s", i+1, numFeeds, entry.Title)
-		// todo remove from numfeeds
-		if entry.XmlURL == "" {
-			log.Printf("no xml url %s", entry.Title)
-			continue
+	// when most feeds fail the problem is likely the network and not the
+	// feeds, so keep the input as it is
+	if checked := len(res.Kept) + len(res.Failed); failThreshold > 0 && checked > 0 {
+		if share := float64(len(res.Failed)) / float64(checked); share > float64(failThreshold) {
+			summaryf("%s", cleanup.Colorize(cleanup.Red, fmt.Sprintf("%.0f%% of the feeds failed, more than -fail-threshold %s, not writing any output", share*100, failThreshold)))
+			finish(0, exitTooManyFailed)
 		}
+	}
 
-		// fetch and parse feed
-		_, err := getFeed(entry.XmlURL)
-		if err != nil {
-			log.Printf("%s", err)
-			failedFeeds = append(failedFeeds, entry)
-			continue
+	// different urls can serve the same feed, which is only known after
+	// fetching them
+	sameContent := map[int]string{}
+	if *dedupeByContent {
+		sameContent = contentDuplicates(res.Kept)
+		for _, r := range res.Kept {
+			if u, ok := sameContent[r.Index]; ok {
+				infof("%s: same content as %s", cleanup.RedactURL(r.Entry.XmlURL), cleanup.RedactURL(u))
+			}
+		}
+		summaryf("content duplicates: %d", len(sameContent))
+	}
+
+	all := res.All()
+
+	if *report != "" {
+		if err := writeReport(*report, *reportFile, all, allowed); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *listFailed {
+		if err := writeOutput("", failedWriter{}, Result{Feeds: all}); err != nil {
+			log.Fatal(err)
+		}
+		code := 0
+		if *failOnError && len(res.Failed) > 0 {
+			code = exitFailedFeeds
+		}
+		finish(0, code)
+		return
+	}
+
+	// keep only the feeds that were checked successfully, keeping the
+	// categories, and update the urls of feeds that moved permanently.
+	// Feeds skipped because of the deadline or an interrupt are kept as
+	// well, and so are failed feeds with -keep-failed.
+	byIndex := map[int]cleanup.FeedResult{}
+	for _, r := range all {
+		byIndex[r.Index] = r
+	}
+	declined := map[int]bool{}
+	if *interactive && !*keepFailed && !*dryRun {
+		if isTerminal(os.Stdin) {
+			var ask []cleanup.FeedResult
+			for _, r := range res.Failed {
+				if !allowed.matches(r.Entry.XmlURL) {
+					ask = append(ask, r)
+				}
+			}
+			declined = confirmRemovals(os.Stdin, os.Stderr, ask)
+		} else {
+			warnf("stdin is not a terminal, ignoring -interactive")
+		}
+	}
+	kept := cleanup.FilterOutlines(opml.Body.Outline, *pruneEmpty, func(i int, o *cleanup.Outline) bool {
+		r := byIndex[i]
+		switch {
+		case r.Skipped && *recheckFailed != "":
+			removed = append(removed, *o)
+			return false
+		case r.Skipped:
+			// feeds cancelled while being checked also have an error
+			return true
+		case r.Err != nil && allowed.matches(o.XmlURL):
+			infof("allowed host, keeping failed feed: %s", cleanup.RedactURL(o.XmlURL))
+			return true
+		case r.Err != nil && declined[i]:
+			// the removal was declined with -interactive
+			return true
+		case r.Err != nil && !*keepFailed:
+			diff.removed = append(diff.removed, change{title: o.Title, url: o.XmlURL, detail: r.Err.Error()})
+			removed = append(removed, *o)
+			return false
+		case r.Err != nil:
+			o.Status = "failed"
+			o.StatusError = r.Err.Error()
+			return true
+		case sameContent[i] != "":
+			diff.removed = append(diff.removed, change{title: o.Title, url: o.XmlURL, detail: "same content as " + sameContent[i]})
+			removed = append(removed, *o)
+			return false
+		case *removeStale && r.Stale:
+			detail := "stale since " + r.Updated.Format("2006-01-02")
+			diff.removed = append(diff.removed, change{title: o.Title, url: o.XmlURL, detail: detail})
+			removed = append(removed, *o)
+			return false
+		}
+		if !r.Skipped {
+			o.Status = ""
+			o.StatusError = ""
+		}
+		if r.Fixed != "" {
+			infof("%s: using %s", cleanup.RedactURL(o.XmlURL), cleanup.RedactURL(r.Fixed))
+			diff.rewritten = append(diff.rewritten, change{title: o.Title, url: o.XmlURL, detail: r.Fixed})
+			o.XmlURL = r.Fixed
+		}
+		if r.Upgraded != "" {
+			infof("%s upgraded to https", cleanup.RedactURL(o.XmlURL))
+			diff.rewritten = append(diff.rewritten, change{title: o.Title, url: o.XmlURL, detail: r.Upgraded})
+			o.XmlURL = r.Upgraded
 		}
+		if r.Discovered != "" {
+			infof("%s: using discovered feed %s", cleanup.RedactURL(o.XmlURL), cleanup.RedactURL(r.Discovered))
+			diff.rewritten = append(diff.rewritten, change{title: o.Title, url: o.XmlURL, detail: r.Discovered})
+			o.XmlURL = r.Discovered
+		}
+		if r.Alternate != "" {
+			infof("%s: using alternate %s", cleanup.RedactURL(o.XmlURL), cleanup.RedactURL(r.Alternate))
+			diff.rewritten = append(diff.rewritten, change{title: o.Title, url: o.XmlURL, detail: r.Alternate})
+			o.XmlURL = r.Alternate
+		}
+		if r.MovedTo != "" {
+			infof("%s moved permanently to %s", cleanup.RedactURL(o.XmlURL), cleanup.RedactURL(r.MovedTo))
+			diff.rewritten = append(diff.rewritten, change{title: o.Title, url: o.XmlURL, detail: r.MovedTo})
+			o.XmlURL = r.MovedTo
+		}
+		if r.Stripped != "" && r.Stripped != o.XmlURL {
+			infof("%s: removed the query", cleanup.RedactURL(o.XmlURL))
+			diff.rewritten = append(diff.rewritten, change{title: o.Title, url: o.XmlURL, detail: r.Stripped})
+			o.XmlURL = r.Stripped
+		}
+		if *normalizeURLs {
+			if u := normalizeURL(o.XmlURL); u != o.XmlURL {
+				debugf("normalized %s to %s", cleanup.RedactURL(o.XmlURL), cleanup.RedactURL(u))
+				diff.rewritten = append(diff.rewritten, change{title: o.Title, url: o.XmlURL, detail: u})
+				o.XmlURL = u
+			}
+			if o.HtmlURL != "" {
+				o.HtmlURL = normalizeURL(o.HtmlURL)
+			}
+		}
+		if *fillTitles && !r.Skipped && o.Title == "" && o.Text == "" {
+			o.Title = r.FeedTitle
+			if o.Title == "" {
+				o.Title = urlHost(o.XmlURL)
+			}
+			o.Text = o.Title
+			infof("%s: filled in title %q", cleanup.RedactURL(o.XmlURL), o.Title)
+			diff.titled = append(diff.titled, change{url: o.XmlURL, detail: o.Title})
+		}
+		if *normalizeType && (r.FeedType == "rss" || r.FeedType == "atom") && o.Type != r.FeedType {
+			debugf("%s: type %q is %s", cleanup.RedactURL(o.XmlURL), o.Type, r.FeedType)
+			o.Type = r.FeedType
+		}
+		if *syncTitleText {
+			if o.Title == "" {
+				o.Title = o.Text
+			} else if o.Text == "" {
+				o.Text = o.Title
+			}
+		}
+		return true
+	})
+
+	if *showDiff {
+		if err := writeDiffFile(*diffFile, diff); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-		successFeeds = append(successFeeds, entry)
+	if *csvFile != "" {
+		if err := writeOutput(*csvFile, csvWriter{}, Result{Feeds: all}); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// the removed file of -recheck-failed is also its input, which a
+	// dry run leaves alone
+	if *removedOutput != "" && !(*dryRun && *recheckFailed != "") {
+		head := cleanup.Head{Title: "removed feeds"}
+		if *recheckFailed != "" {
+			head = opml.Head
+		} else if opml.Head.Title != "" {
+			head.Title = opml.Head.Title + " (removed feeds)"
+		}
+		if err := writeOpml(*removedOutput, cleanup.CreateOpml(opml.Version, head, removed), format); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *dryRun {
+		for _, c := range diff.removed {
+			summaryf("would remove: %s %s (%s)", c.title, cleanup.RedactURL(c.url), c.detail)
+		}
+		summaryf("would remove %d feeds", len(diff.removed))
+		code := 0
+		if len(res.Failed) > 0 {
+			code = exitFailedFeeds
+		}
+		finish(len(diff.removed), code)
+		return
+	}
+
+	if *sortBy != "none" {
+		cleanup.SortOutlines(kept, *sortBy)
 	}
-	log.Printf("success: %d failed: %d", len(successFeeds), len(failedFeeds))
 
 	// generate new feed and write to file
-	newOpml := createOpml(successFeeds)
-	output, err := xml.MarshalIndent(newOpml, "", "  ")
-	if err != nil {
+	newOpml := cleanup.CreateOpml(opml.Version, opml.Head, kept)
+	newOpml.Extra = opml.Extra
+	if err := writeOutput(*outputFile, ow, Result{Opml: newOpml, Feeds: all, Allowed: allowed}); err != nil {
 		log.Fatal(err)
 	}
-	fmt.Printf("%s", xml.Header)
-	fmt.Printf("%s", output)
+
+	code := 0
+	if *failOnError && len(res.Failed) > 0 {
+		code = exitFailedFeeds
+	}
+	finish(len(diff.removed), code)
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runMain runs main with args in a new process of the test binary,
+// since main exits the process
+func runMain(t *testing.T, args ...string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^TestMainProcess$", "--"}, args...)...)
+	cmd.Env = append(os.Environ(), "TEST_MAIN_PROCESS=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+}
+
+// TestMainProcess is the process started by runMain
+func TestMainProcess(t *testing.T) {
+	if os.Getenv("TEST_MAIN_PROCESS") != "1" {
+		return
+	}
+	args := os.Args
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	os.Args = append([]string{"opml-cleanup"}, args...)
+	main()
+	os.Exit(0)
+}
+
+func TestRemovedOutputKeepsNotes(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "feeds.opml")
+	err := ioutil.WriteFile(input, []byte(`<opml version="2.0">
+  <head><title>feeds</title></head>
+  <body>
+    <outline text="Dead">
+      <outline text="Read these first"/>
+      <outline text="Blog" xmlUrl="`+srv.URL+`/feed"/>
+    </outline>
+  </body>
+</opml>`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "cleaned.opml")
+	removedOutput := filepath.Join(dir, "removed.opml")
+	runMain(t, "-input", input, "-output", output, "-removed-output", removedOutput, "-log-level", "quiet")
+
+	kept, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := ioutil.ReadFile(removedOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// notes stay in the output, only the feed is moved to the removed file
+	if !strings.Contains(string(kept), "Read these first") || strings.Contains(string(kept), srv.URL) {
+		t.Errorf("output:\n%s", kept)
+	}
+	if strings.Contains(string(removed), "Read these first") || !strings.Contains(string(removed), srv.URL) {
+		t.Errorf("removed file:\n%s", removed)
+	}
+}
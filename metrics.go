@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// writeMetrics writes the results of the run to filename in the
+// Prometheus text format, e.g. for the textfile collector of
+// node_exporter. The metric names are kept stable:
+//
+//	opml_cleanup_feeds                       number of feeds checked
+//	opml_cleanup_feeds_ok                    feeds that were fetched and parsed
+//	opml_cleanup_feeds_failed{category}      failed feeds per failure category
+//	opml_cleanup_feeds_skipped               feeds not checked before the deadline
+//	opml_cleanup_run_duration_seconds        duration of the run
+//	opml_cleanup_last_run_timestamp_seconds  end of the run as a unix timestamp
+func writeMetrics(filename string, ok, failed, skipped int, counts map[string]int, duration time.Duration) error {
+	var buf bytes.Buffer
+	gauge := func(name, help string, value interface{}) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+	gauge("opml_cleanup_feeds", "Number of feeds checked.", ok+failed+skipped)
+	gauge("opml_cleanup_feeds_ok", "Number of feeds that were fetched and parsed.", ok)
+
+	fmt.Fprintf(&buf, "# HELP opml_cleanup_feeds_failed Number of failed feeds by failure category.\n")
+	fmt.Fprintf(&buf, "# TYPE opml_cleanup_feeds_failed gauge\n")
+	for _, category := range failCategories {
+		fmt.Fprintf(&buf, "opml_cleanup_feeds_failed{category=%q} %d\n", category, counts[category])
+	}
+
+	gauge("opml_cleanup_feeds_skipped", "Number of feeds that weren't checked.", skipped)
+	gauge("opml_cleanup_run_duration_seconds", "Duration of the run.", duration.Seconds())
+	gauge("opml_cleanup_last_run_timestamp_seconds", "Time the run finished as a unix timestamp.", time.Now().Unix())
+	return writeFileAtomic(filename, buf.Bytes())
+}
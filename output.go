@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/arthurk/feed/cleanup"
+)
+
+// writeFileAtomic writes data to filename by writing it to a temporary
+// file in the same directory and renaming it over filename, so filename
+// is never left partially written. The temporary file is removed on error.
+func writeFileAtomic(filename string, data []byte) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(0644); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), filename)
+	return err
+}
+
+// opmlFormat controls how OPML documents are written
+type opmlFormat struct {
+	// indent is the indentation of nested elements, empty for compact
+	// output
+	indent string
+	// encoding is the encoding attribute of the XML declaration. The
+	// output itself is always UTF-8.
+	encoding string
+	// noHeader omits the XML declaration
+	noHeader bool
+}
+
+// parseIndent parses the -indent flag, which is either a number of
+// spaces, "tab", or the literal indentation
+func parseIndent(s string) string {
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return strings.Repeat(" ", n)
+	}
+	if s == "tab" || s == `\t` {
+		return "\t"
+	}
+	return s
+}
+
+// Result is the outcome of a run as written by an OutputWriter
+type Result struct {
+	// Opml is the cleaned document
+	Opml cleanup.Opml
+	// Feeds holds the results of all checked feeds in document order
+	Feeds []cleanup.FeedResult
+	// Allowed holds the -allow-hosts, whose failed feeds are kept
+	Allowed hostSet
+}
+
+// OutputWriter writes the result of a run in some format
+type OutputWriter interface {
+	Write(w io.Writer, r Result) error
+}
+
+// newOutputWriter returns the writer for the -format flag. OPML is
+// written in the given opml format.
+func newOutputWriter(name string, format opmlFormat) (OutputWriter, error) {
+	switch name {
+	case "opml":
+		return opmlWriter{format: format}, nil
+	case "json":
+		return jsonWriter{}, nil
+	case "html":
+		return htmlWriter{}, nil
+	case "csv":
+		return csvWriter{}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", name)
+}
+
+// opmlWriter writes the cleaned document
+type opmlWriter struct {
+	format opmlFormat
+}
+
+func (ow opmlWriter) Write(w io.Writer, r Result) error {
+	var output []byte
+	var err error
+	if ow.format.indent == "" {
+		output, err = xml.Marshal(r.Opml)
+	} else {
+		output, err = xml.MarshalIndent(r.Opml, "", ow.format.indent)
+	}
+	if err != nil {
+		return err
+	}
+	if !ow.format.noHeader {
+		var encoding bytes.Buffer
+		xml.EscapeText(&encoding, []byte(ow.format.encoding))
+		fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"%s\"?>\n", encoding.String())
+	}
+	// some parsers expect a newline at the end
+	_, err = w.Write(append(output, '\n'))
+	return err
+}
+
+// jsonWriter writes the JSON report of all checked feeds
+type jsonWriter struct{}
+
+func (jsonWriter) Write(w io.Writer, r Result) error {
+	return writeJSONReport(w, r.Feeds)
+}
+
+// htmlWriter writes the HTML report of all checked feeds
+type htmlWriter struct{}
+
+func (htmlWriter) Write(w io.Writer, r Result) error {
+	return writeHTMLReport(w, r.Feeds, r.Allowed)
+}
+
+// csvWriter writes a row for each checked feed, including the removed
+// ones
+type csvWriter struct{}
+
+func (csvWriter) Write(w io.Writer, r Result) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"title", "xmlUrl", "htmlUrl", "type", "status", "httpStatus", "durationMs", "error"})
+	for _, fr := range r.Feeds {
+		e := newReportEntry(fr)
+		httpStatus := ""
+		if e.StatusCode != 0 {
+			httpStatus = strconv.Itoa(e.StatusCode)
+		}
+		duration := ""
+		if !fr.Skipped {
+			duration = strconv.FormatInt(e.DurationMs, 10)
+		}
+		cw.Write([]string{e.Title, e.XmlURL, e.HtmlURL, e.Type, e.Status, httpStatus, duration, e.Error})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// failedWriter writes a line for each failed feed with its title, url and
+// error separated by tabs, for -list-failed
+type failedWriter struct{}
+
+func (failedWriter) Write(w io.Writer, r Result) error {
+	// tabs and newlines in the fields would break the columns
+	clean := strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+	for _, fr := range r.Feeds {
+		if fr.Err == nil {
+			continue
+		}
+		title := fr.Entry.Title
+		if title == "" {
+			title = fr.Entry.Text
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", clean.Replace(title), clean.Replace(fr.Entry.XmlURL), clean.Replace(fr.Err.Error())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeOutput writes r with ow to filename, or to stdout if filename is
+// empty
+func writeOutput(filename string, ow OutputWriter, r Result) error {
+	var buf bytes.Buffer
+	if err := ow.Write(&buf, r); err != nil {
+		return err
+	}
+	if filename == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err := writeFileAtomic(filename, buf.Bytes()); err != nil {
+		return err
+	}
+	infof("wrote %s", filename)
+	return nil
+}
+
+// writeOpml writes o in the given format to filename, or to stdout if
+// filename is empty
+func writeOpml(filename string, o cleanup.Opml, format opmlFormat) error {
+	return writeOutput(filename, opmlWriter{format: format}, Result{Opml: o})
+}
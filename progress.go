@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressInterval is how often progress is printed when stderr is not a
+// terminal
+const progressInterval = 5 * time.Second
+
+// progress shows how many feeds have been checked. On a terminal it draws
+// a bar that is updated in place, otherwise it prints a line periodically.
+// It is also used as the output of the log package so that log lines
+// don't get mixed up with the bar.
+type progress struct {
+	mu        sync.Mutex
+	out       io.Writer
+	tty       bool
+	total     int
+	done      int
+	failed    int
+	lastPrint time.Time
+}
+
+func newProgress(out io.Writer, tty bool, total int) *progress {
+	return &progress{out: out, tty: tty, total: total, lastPrint: time.Now()}
+}
+
+// update records a checked feed
+func (p *progress) update(failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if failed {
+		p.failed++
+	}
+	if p.tty {
+		p.draw()
+	} else if time.Since(p.lastPrint) >= progressInterval || p.done == p.total {
+		fmt.Fprintf(p.out, "checked %d/%d, %d failed\n", p.done, p.total, p.failed)
+		p.lastPrint = time.Now()
+	}
+}
+
+// draw redraws the progress bar. p.mu must be held.
+func (p *progress) draw() {
+	const width = 30
+	filled := width
+	if p.total > 0 {
+		filled = width * p.done / p.total
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+	fmt.Fprintf(p.out, "\r[%s] %d/%d, %d failed", bar, p.done, p.total, p.failed)
+}
+
+// clear removes the progress bar from the terminal. p.mu must be held.
+func (p *progress) clear() {
+	fmt.Fprint(p.out, "\r\033[K")
+}
+
+// Write writes a log line above the progress bar
+func (p *progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.tty {
+		return p.out.Write(b)
+	}
+	p.clear()
+	n, err := p.out.Write(b)
+	if p.done < p.total {
+		p.draw()
+	}
+	return n, err
+}
+
+// finish ends the progress bar so that following output starts on a new
+// line
+func (p *progress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty {
+		p.clear()
+		p.draw()
+		fmt.Fprintln(p.out)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"os"
+	"time"
+
+	"github.com/arthurk/feed/cleanup"
+)
+
+// reportEntry is the JSON representation of a checked feed
+type reportEntry struct {
+	Title      string `json:"title"`
+	XmlURL     string `json:"xmlUrl"`
+	HtmlURL    string `json:"htmlUrl,omitempty"`
+	Type       string `json:"type,omitempty"`
+	Status     string `json:"status"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	DurationMs int64  `json:"durationMs,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// DeadEnclosure is the url of the newest enclosure if it is gone
+	DeadEnclosure string `json:"deadEnclosure,omitempty"`
+	Updated       string `json:"updated,omitempty"`
+	// HtmlStatus is the status of the site url, only set with
+	// -check-htmlurl
+	HtmlStatus     string `json:"htmlStatus,omitempty"`
+	HtmlStatusCode int    `json:"htmlStatusCode,omitempty"`
+	HtmlError      string `json:"htmlError,omitempty"`
+}
+
+// newReportEntry returns the report entry for r
+func newReportEntry(r cleanup.FeedResult) reportEntry {
+	e := reportEntry{
+		Title:      r.Entry.Title,
+		XmlURL:     r.Entry.XmlURL,
+		HtmlURL:    r.Entry.HtmlURL,
+		Type:       r.Entry.Type,
+		Status:     "ok",
+		StatusCode: r.StatusCode,
+		DurationMs: r.Duration.Milliseconds(),
+
+		DeadEnclosure: r.DeadEnclosure,
+	}
+	if r.Skipped {
+		e.Status = "skipped"
+	} else if r.Err != nil {
+		e.Status = "failed"
+		e.Error = r.Err.Error()
+	} else if r.Stale {
+		e.Status = "stale"
+	}
+	if !r.Updated.IsZero() {
+		e.Updated = r.Updated.Format(time.RFC3339)
+	}
+	if r.HTMLErr != nil {
+		e.HtmlStatus = "failed"
+		e.HtmlError = r.HTMLErr.Error()
+	} else if r.HTMLStatus != 0 {
+		e.HtmlStatus = "ok"
+	}
+	e.HtmlStatusCode = r.HTMLStatus
+	return e
+}
+
+// writeReport writes a report of results in the given format to
+// filename, or to stderr if filename is empty. Failed feeds on allowed
+// hosts are reported as kept.
+func writeReport(format, filename string, results []cleanup.FeedResult, allowed hostSet) error {
+	ow, err := newOutputWriter(format, opmlFormat{})
+	if err != nil {
+		return err
+	}
+	if filename == "" {
+		return ow.Write(os.Stderr, Result{Feeds: results, Allowed: allowed})
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := ow.Write(f, Result{Feeds: results, Allowed: allowed}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// jsonReport is the JSON report of a run
+type jsonReport struct {
+	Version string        `json:"version"`
+	Commit  string        `json:"commit"`
+	Feeds   []reportEntry `json:"feeds"`
+}
+
+// writeJSONReport writes results to w as a JSON object with the version
+// of the program and an array of the feeds
+func writeJSONReport(w io.Writer, results []cleanup.FeedResult) error {
+	report := jsonReport{
+		Version: version,
+		Commit:  commit,
+		Feeds:   []reportEntry{},
+	}
+	for _, r := range results {
+		report.Feeds = append(report.Feeds, newReportEntry(r))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Feed report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+th { background: #eee; }
+</style>
+</head>
+<body>
+<h1>Feed report</h1>
+{{range .}}
+<h2>{{.Name}} ({{len .Entries}})</h2>
+<table>
+<tr><th>Title</th><th>Feed</th><th>Status</th><th>HTTP status</th><th>Error</th></tr>
+{{range .Entries}}<tr>
+<td>{{if .HtmlURL}}<a href="{{.HtmlURL}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</td>
+<td><a href="{{.XmlURL}}">{{.XmlURL}}</a></td>
+<td>{{.Status}}</td>
+<td>{{if .StatusCode}}{{.StatusCode}}{{end}}</td>
+<td>{{.Error}}</td>
+</tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+// writeHTMLReport writes results to w as a standalone HTML page with
+// tables of the kept and removed feeds. Failed feeds on allowed hosts
+// have their own table since they are kept.
+func writeHTMLReport(w io.Writer, results []cleanup.FeedResult, allowed hostSet) error {
+	type section struct {
+		Name    string
+		Entries []reportEntry
+	}
+	kept := section{Name: "Kept"}
+	keptAllowed := section{Name: "Kept (allowed host)"}
+	removed := section{Name: "Removed"}
+	for _, r := range results {
+		switch {
+		case r.Err != nil && allowed.matches(r.Entry.XmlURL):
+			keptAllowed.Entries = append(keptAllowed.Entries, newReportEntry(r))
+		case r.Err != nil:
+			removed.Entries = append(removed.Entries, newReportEntry(r))
+		default:
+			kept.Entries = append(kept.Entries, newReportEntry(r))
+		}
+	}
+	sections := []section{kept, removed}
+	if len(keptAllowed.Entries) > 0 {
+		sections = []section{kept, keptAllowed, removed}
+	}
+	return htmlReport.Execute(w, sections)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/arthurk/feed/cleanup"
+)
+
+func TestHTMLReportAllowedHosts(t *testing.T) {
+	results := []cleanup.FeedResult{
+		{Entry: cleanup.Outline{XmlURL: "https://example.com/ok"}},
+		{Entry: cleanup.Outline{XmlURL: "https://feeds.example.org/flaky"}, Err: errors.New("status 503")},
+		{Entry: cleanup.Outline{XmlURL: "https://dead.example/feed"}, Err: errors.New("status 404")},
+	}
+	allowed, err := loadHostSet("example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeHTMLReport(&buf, results, allowed); err != nil {
+		t.Fatal(err)
+	}
+	for _, heading := range []string{"<h2>Kept (1)</h2>", "<h2>Kept (allowed host) (1)</h2>", "<h2>Removed (1)</h2>"} {
+		if !strings.Contains(buf.String(), heading) {
+			t.Errorf("missing %s", heading)
+		}
+	}
+}
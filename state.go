@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/arthurk/feed/cleanup"
+)
+
+// stateEntry is the result of the last check of a feed
+type stateEntry struct {
+	Checked    time.Time `json:"checked"`
+	Error      string    `json:"error,omitempty"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	MovedTo    string    `json:"movedTo,omitempty"`
+	Updated    time.Time `json:"updated"`
+	Stale      bool      `json:"stale,omitempty"`
+	FeedTitle  string    `json:"feedTitle,omitempty"`
+	FeedType   string    `json:"feedType,omitempty"`
+}
+
+// runState maps feed urls to the results of their last check, so an
+// interrupted run can be resumed without checking every feed again
+type runState map[string]stateEntry
+
+// loadState reads the state from filename. A missing or corrupt file
+// results in an empty state, so all feeds are checked.
+func loadState(filename string) runState {
+	state := runState{}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			warnf("reading state: %s", err)
+		}
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		warnf("ignoring corrupt state %s: %s", filename, err)
+		return runState{}
+	}
+	return state
+}
+
+// save writes the state to filename
+func (s runState) save(filename string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, append(data, '\n'))
+}
+
+// previous returns a function for cleanup.Checker.Previous that reuses
+// the results of feeds checked less than maxAge ago
+func (s runState) previous(maxAge time.Duration) func(cleanup.Outline) (cleanup.FeedResult, bool) {
+	return func(o cleanup.Outline) (cleanup.FeedResult, bool) {
+		e, ok := s[o.XmlURL]
+		if !ok || time.Since(e.Checked) > maxAge {
+			return cleanup.FeedResult{}, false
+		}
+		r := cleanup.FeedResult{
+			StatusCode: e.StatusCode,
+			MovedTo:    e.MovedTo,
+			Updated:    e.Updated,
+			Stale:      e.Stale,
+			FeedTitle:  e.FeedTitle,
+			FeedType:   e.FeedType,
+		}
+		if e.Error != "" {
+			r.Err = errors.New(e.Error)
+		}
+		return r, true
+	}
+}
+
+// update records the results of all feeds that were checked in this run
+func (s runState) update(results []cleanup.FeedResult) {
+	now := time.Now()
+	for _, r := range results {
+		if r.Skipped || r.Reused {
+			continue
+		}
+		e := stateEntry{
+			Checked:    now,
+			StatusCode: r.StatusCode,
+			MovedTo:    r.MovedTo,
+			Updated:    r.Updated,
+			Stale:      r.Stale,
+			FeedTitle:  r.FeedTitle,
+			FeedType:   r.FeedType,
+		}
+		if r.Err != nil {
+			e.Error = r.Err.Error()
+		}
+		s[r.Entry.XmlURL] = e
+	}
+}
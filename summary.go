@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"time"
+)
+
+// runSummary is the summary of a run printed by -summary-json
+type runSummary struct {
+	Feeds   int `json:"feeds"`
+	OK      int `json:"ok"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+	Stale   int `json:"stale"`
+	// Removed is the number of feeds removed from the output, including
+	// duplicates and denied hosts
+	Removed int `json:"removed"`
+	// KeptAllowed is the number of failed feeds that were kept because
+	// their host is in -allow-hosts
+	KeptAllowed int            `json:"keptAllowed,omitempty"`
+	Failures    map[string]int `json:"failures,omitempty"`
+	DurationMs  int64          `json:"durationMs"`
+	// Reason is why the run ended: "completed", "interrupted",
+	// "deadline" or "failed feeds" if it exits with exitFailedFeeds
+	Reason   string `json:"reason"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// webhookAttempts is the number of times a webhook is tried
+const webhookAttempts = 3
+
+// printSummary writes s to stdout as a single line of JSON
+func printSummary(s runSummary) error {
+	return json.NewEncoder(os.Stdout).Encode(s)
+}
+
+// postWebhook posts s as JSON to url, retrying connection errors and 5xx
+// responses. Each attempt is limited to a few seconds so a broken webhook
+// doesn't hold up the exit.
+func postWebhook(client *http.Client, url string, s runSummary) error {
+	body, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	c := *client
+	c.Timeout = 10 * time.Second
+	for attempt := 1; ; attempt++ {
+		resp, err := c.Post(url, "application/json", bytes.NewReader(body))
+		// webhook urls often contain a secret, so leave them out of
+		// the errors
+		var uerr *neturl.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		if err == nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				infof("webhook: %s", resp.Status)
+				return nil
+			}
+			err = fmt.Errorf("responded with %s", resp.Status)
+			if resp.StatusCode < 500 {
+				return err
+			}
+		}
+		if attempt == webhookAttempts {
+			return err
+		}
+		warnf("webhook: %s, retrying", err)
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
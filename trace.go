@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/arthurk/feed/cleanup"
+)
+
+// traceRecord is a line of the -trace-file. The durations are measured
+// from the start of the request.
+type traceRecord struct {
+	Time           string      `json:"time"`
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	RequestHeader  http.Header `json:"requestHeader"`
+	Status         int         `json:"status,omitempty"`
+	ResponseHeader http.Header `json:"responseHeader,omitempty"`
+	Error          string      `json:"error,omitempty"`
+	RemoteAddr     string      `json:"remoteAddr,omitempty"`
+	ReusedConn     bool        `json:"reusedConn"`
+	DNSMs          float64     `json:"dnsMs,omitempty"`
+	ConnectMs      float64     `json:"connectMs,omitempty"`
+	TLSMs          float64     `json:"tlsMs,omitempty"`
+	// FirstByteMs is the time until the response headers arrived
+	FirstByteMs float64 `json:"firstByteMs,omitempty"`
+}
+
+// traceTransport writes a traceRecord for every request sent through it
+// to a file. It is safe for concurrent use.
+type traceTransport struct {
+	next http.RoundTripper
+	mu   sync.Mutex
+	f    *os.File
+}
+
+// newTraceTransport returns a transport that traces the requests sent
+// through next to the file filename
+func newTraceTransport(next http.RoundTripper, filename string) (*traceTransport, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &traceTransport{next: next, f: f}, nil
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	since := func() float64 {
+		return float64(time.Since(start)) / float64(time.Millisecond)
+	}
+	rec := traceRecord{
+		Time:          start.UTC().Format(time.RFC3339Nano),
+		Method:        req.Method,
+		URL:           cleanup.RedactURL(req.URL.String()),
+		RequestHeader: cleanup.RedactHeader(req.Header),
+	}
+	// the hooks of the trace are called from other goroutines, the
+	// record is only written after the response arrived
+	var mu sync.Mutex
+	ctx := httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			mu.Lock()
+			rec.DNSMs = since()
+			mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, _ error) {
+			mu.Lock()
+			rec.ConnectMs = since()
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			mu.Lock()
+			rec.TLSMs = since()
+			mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			mu.Lock()
+			rec.RemoteAddr = info.Conn.RemoteAddr().String()
+			rec.ReusedConn = info.Reused
+			mu.Unlock()
+		},
+	})
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+
+	mu.Lock()
+	rec.FirstByteMs = since()
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		rec.Status = resp.StatusCode
+		rec.ResponseHeader = cleanup.RedactHeader(resp.Header)
+	}
+	line, jerr := json.Marshal(rec)
+	mu.Unlock()
+	if jerr == nil {
+		t.mu.Lock()
+		t.f.Write(append(line, '\n'))
+		t.mu.Unlock()
+	}
+	return resp, err
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/arthurk/feed/cleanup"
+	"golang.org/x/net/idna"
+)
+
+// dedupeKey returns a normalized form of a feed url that is the same for
+// urls that most likely point to the same feed. The scheme is ignored,
+// the host is lowercased, default ports and trailing slashes are removed.
+func dedupeKey(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	key := host + strings.TrimRight(u.EscapedPath(), "/")
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key
+}
+
+// normalizeURL returns raw in a canonical form: the scheme and host are
+// lowercased, international domain names are converted to punycode,
+// default ports and the fragment are removed, and percent-encoding in the
+// path uses uppercase hex digits with unreserved characters decoded. The
+// query is kept as it is since some feeds depend on it. raw is returned
+// unchanged if it can't be parsed.
+func normalizeURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host := strings.ToLower(u.Hostname())
+	if net.ParseIP(host) == nil {
+		if host, err = idna.Lookup.ToASCII(host); err != nil {
+			return raw
+		}
+	}
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	escaped := normalizePercent(u.EscapedPath())
+	if path, err := url.PathUnescape(escaped); err == nil {
+		u.Path = path
+		u.RawPath = escaped
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
+
+// normalizePercent uppercases the hex digits of percent-encoded bytes in
+// s and decodes the ones that don't need to be encoded
+func normalizePercent(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		c, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			b.WriteByte(s[i])
+			continue
+		}
+		if isUnreserved(byte(c)) {
+			b.WriteByte(byte(c))
+		} else {
+			b.WriteString("%" + strings.ToUpper(s[i+1:i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+// isUnreserved reports whether c may appear in a url without encoding
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// dedupeOutlines removes feeds from the outline tree whose url is a
+// duplicate of an earlier feed and returns the new tree and the removed
+// feeds
+func dedupeOutlines(outlines []cleanup.Outline) ([]cleanup.Outline, []cleanup.Outline) {
+	seen := map[string]bool{}
+	removed := []cleanup.Outline{}
+	deduped := cleanup.FilterOutlines(outlines, false, func(i int, o *cleanup.Outline) bool {
+		key := dedupeKey(o.XmlURL)
+		if seen[key] {
+			debugf("duplicate: %s", cleanup.RedactURL(o.XmlURL))
+			removed = append(removed, *o)
+			return false
+		}
+		seen[key] = true
+		return true
+	})
+	return deduped, removed
+}
+
+// contentDuplicates finds the feeds in results that serve the same content
+// as another feed and returns their indexes mapped to the url of the feed
+// that is kept instead. Of each group the feed with the cleanest url is
+// kept, see cleanerURL.
+func contentDuplicates(results []cleanup.FeedResult) map[int]string {
+	best := map[string]cleanup.FeedResult{}
+	for _, r := range results {
+		if r.ContentHash == "" {
+			continue
+		}
+		if b, ok := best[r.ContentHash]; !ok || cleanerURL(r.Entry.XmlURL, b.Entry.XmlURL) {
+			best[r.ContentHash] = r
+		}
+	}
+	duplicates := map[int]string{}
+	for _, r := range results {
+		if b, ok := best[r.ContentHash]; ok && b.Index != r.Index {
+			duplicates[r.Index] = b.Entry.XmlURL
+		}
+	}
+	return duplicates
+}
+
+// cleanerURL reports whether a is a cleaner url than b: https before http,
+// urls without a query before urls with one, then shorter urls
+func cleanerURL(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return errB != nil && errA == nil
+	}
+	if (ua.Scheme == "https") != (ub.Scheme == "https") {
+		return ua.Scheme == "https"
+	}
+	if (ua.RawQuery == "") != (ub.RawQuery == "") {
+		return ua.RawQuery == ""
+	}
+	return len(a) < len(b)
+}
+
+// urlHost returns the host of raw without the port, or raw itself if it
+// can't be parsed
+func urlHost(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return raw
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"unchanged", "https://example.com/feed.xml", "https://example.com/feed.xml"},
+		{"scheme and host case", "HTTPS://Example.COM/Feed.xml", "https://example.com/Feed.xml"},
+		{"punycode", "https://bücher.example/feed", "https://xn--bcher-kva.example/feed"},
+		{"punycode uppercase", "https://BÜCHER.example/feed", "https://xn--bcher-kva.example/feed"},
+		{"default http port", "http://example.com:80/feed", "http://example.com/feed"},
+		{"default https port", "https://example.com:443/feed", "https://example.com/feed"},
+		{"other port", "https://example.com:8443/feed", "https://example.com:8443/feed"},
+		{"https port on http", "http://example.com:443/feed", "http://example.com:443/feed"},
+		{"ipv6 default port", "http://[::1]:80/feed", "http://[::1]/feed"},
+		{"ipv6 other port", "http://[::1]:8080/feed", "http://[::1]:8080/feed"},
+		{"lowercase percent-encoding", "https://example.com/a%2fb", "https://example.com/a%2Fb"},
+		{"unreserved percent-encoding", "https://example.com/%7Euser/%66eed", "https://example.com/~user/feed"},
+		{"encoded space", "https://example.com/my%20feed", "https://example.com/my%20feed"},
+		{"fragment", "https://example.com/feed#top", "https://example.com/feed"},
+		{"query kept", "https://example.com/feed?B=1&a=%7e", "https://example.com/feed?B=1&a=%7e"},
+		{"surrounding space", "  https://example.com/feed  ", "https://example.com/feed"},
+		{"no host", "feed.xml", "feed.xml"},
+		{"unparsable", "http://[::1/feed", "http://[::1/feed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeURL(tt.in); got != tt.want {
+				t.Errorf("normalizeURL(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+// Build information, set at build time with
+//
+//	go build -ldflags "-X main.version=1.0.0 -X main.commit=$(git rev-parse --short HEAD) -X main.date=$(date -u +%Y-%m-%d)"
+var (
+	version = "dev"
+	commit  = "unknown"
+	date    = "unknown"
+)
+
+// versionString returns the build information in a single line
+func versionString() string {
+	return fmt.Sprintf("opml-cleanup %s (commit %s, built %s)", version, commit, date)
+}